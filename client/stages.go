@@ -7,6 +7,7 @@ import (
 	"io"
 	"net/http"
 	"strconv"
+	"strings"
 
 	"github.com/chibuka/95/internal/config"
 )
@@ -16,9 +17,47 @@ type TestConfig struct {
 	TestType      string         `json:"testType"` // "cli_interactive" or "http_server"
 	ProgramConfig *ProgramConfig `json:"programConfig"`
 	ServerConfig  *ServerConfig  `json:"serverConfig"`
-	Tests         []Test         `json:"tests"`
+	// in case testType is "cli_interactive"
+	Interactive *InteractiveConfig `json:"interactive"`
+	// Resource limits for every test of the stage
+	Limits *Limits `json:"limits"`
+	Tests  []Test  `json:"tests"`
 }
 
+// Input modes for cli_interactive tests
+const (
+	InputModePipe = "pipe" // stdin is written to a pipe (default)
+	InputModePTY  = "pty"  // the program is attached to a pseudo-terminal
+)
+
+// InteractiveConfig defines how input is fed to the program for CLI tests
+type InteractiveConfig struct {
+	Mode string `json:"mode"` // "pipe" or "pty"
+	// Printed by the program when it is ready for the next command
+	Prompt string `json:"prompt"`
+	// Silence that counts as ready when no prompt is configured
+	QuietMs int `json:"quietMs"`
+}
+
+// Limits caps the resources a program may use, zero means no limit. Memory,
+// CPU time, processes and open files are only enforced on Linux.
+type Limits struct {
+	MemoryMB     int `json:"memoryMb"`     // address space
+	CPUSeconds   int `json:"cpuSeconds"`   // user + system CPU time
+	MaxProcesses int `json:"maxProcesses"` // processes and threads the program may add
+	MaxOpenFiles int `json:"maxOpenFiles"`
+	MaxOutputKB  int `json:"maxOutputKb"` // captured stdout and stderr, each
+}
+
+// Limit names reported in TestResult.LimitExceeded
+const (
+	LimitMemory    = "memory"
+	LimitCPU       = "cpu"
+	LimitProcesses = "processes"
+	LimitOpenFiles = "open_files"
+	LimitOutput    = "output"
+)
+
 // ProgramConfig defines how to run the user's program for HTTP tests
 type ProgramConfig struct {
 	Executable string            `json:"executable"`
@@ -26,10 +65,72 @@ type ProgramConfig struct {
 	Env        map[string]string `json:"env"`
 }
 
+// Server lifetimes of HTTP tests
+const (
+	ServerLifetimeTest  = "test"  // a new server for every test (default)
+	ServerLifetimeStage = "stage" // one server for all tests of the stage
+)
+
 // ServerConfig defines the server parameters for HTTP tests
 type ServerConfig struct {
 	Port          int `json:"port"`
 	StartupWaitMs int `json:"startupWaitMs"`
+	// "test" or "stage", a stage server is restarted for tests with
+	// FreshServer set, for tests with other Env or Limits than the test
+	// before and after it crashes
+	Lifetime string `json:"lifetime"`
+	// Run the server on a free port instead of Port, passed to the program
+	// in the PORT environment variable. "{port}" in the program arguments is
+	// replaced by the port either way.
+	DynamicPort bool `json:"dynamicPort"`
+	// How to tell the server is ready, a GET / answered by default
+	Readiness *ReadinessProbe `json:"readiness"`
+	// How requests are sent, "standard" or "raw"
+	Client string `json:"client"`
+}
+
+// HTTP clients of a stage
+const (
+	// requests go through Go's HTTP client, which normalizes responses
+	// (default)
+	ClientStandard = "standard"
+	// requests are written byte for byte to a TCP connection and responses
+	// are parsed strictly, for stages about the protocol itself
+	ClientRaw = "raw"
+)
+
+// Readiness probe types
+const (
+	ProbeHTTP = "http" // Path answers, with Status if set (default)
+	ProbeTCP  = "tcp"  // the port accepts connections
+	ProbeLog  = "log"  // the server printed a line matching Pattern
+)
+
+// ReadinessProbe is how the runner waits for a server to be ready, until
+// ServerConfig.StartupWaitMs. Zero fields take the defaults.
+type ReadinessProbe struct {
+	Type string `json:"type"` // "http", "tcp" or "log"
+	// HTTP probe: the path requested, "/" by default, and the status that
+	// counts as ready, any by default
+	Path   string `json:"path"`
+	Status int    `json:"status"`
+	// Log probe: a regular expression matched against each line the server
+	// prints, on stdout or stderr
+	Pattern string `json:"pattern"`
+	// Wait between attempts, 200ms by default. Each wait is Backoff times the
+	// previous one, up to MaxIntervalMs (2000 by default).
+	IntervalMs    int     `json:"intervalMs"`
+	Backoff       float64 `json:"backoff"`
+	MaxIntervalMs int     `json:"maxIntervalMs"`
+}
+
+// ProbeAttempt is one check of a readiness probe
+type ProbeAttempt struct {
+	// Since the server started
+	ElapsedMs int64 `json:"elapsedMs"`
+	Ready     bool  `json:"ready"`
+	// What the probe saw, e.g. "connection refused" or "HTTP 404"
+	Result string `json:"result"`
 }
 
 // CascadedTestConfig represents test configurations for multiple stages
@@ -38,6 +139,8 @@ type CascadedTestConfig struct {
 	TargetStageUuid   string          `json:"targetStageUuid"`
 	TargetStageNumber int             `json:"targetStageNumber"`
 	StagesToRun       []StageTestInfo `json:"stagesToRun"`
+	// Whether results may be submitted for a selection of stages or tests
+	AllowPartialRuns bool `json:"allowPartialRuns"`
 }
 
 type StageTestInfo struct {
@@ -51,18 +154,47 @@ type Test struct {
 	TestName       string `json:"testName"`
 	Stdin          string `json:"stdin"`
 	TimeoutSeconds int    `json:"timeoutSeconds"`
+	// Overrides the stage interactive config for this test
+	Interactive *InteractiveConfig `json:"interactive"`
+	// Overrides the stage limits for this test
+	Limits *Limits `json:"limits"`
 	// in case testType is "http_server"
 	HttpRequests []HttpRequest `json:"httpRequests"`
+	// Start a new server for this test when the server lifetime is "stage"
+	FreshServer bool `json:"freshServer"`
 	// Setup and cleanup operations
 	Setup   *TestSetup   `json:"setup"`
 	Cleanup *TestCleanup `json:"cleanup"`
+	// Environment variables the program runs with, on top of the inherited ones
+	Env map[string]string `json:"env"`
+	// Files and directories to attach to the result after the run
+	Collect []string `json:"collect"`
 	// Note: assertions are stripped by backend
 }
 
+// File content encodings
+const (
+	EncodingText   = "text" // content is written as is (default)
+	EncodingBase64 = "base64"
+)
+
 // Define a new struct for the file items
 type FileCreation struct {
 	Path    string `json:"path"`
 	Content string `json:"content"`
+	// "text" or "base64", for binary fixtures
+	Encoding string `json:"encoding"`
+	// Octal permissions like "0755", defaults to "0644"
+	Mode string `json:"mode"`
+	// RFC 3339 modification time, e.g. "2024-01-02T15:04:05Z"
+	ModTime string `json:"modTime"`
+}
+
+// SymlinkCreation is a symbolic link created at Path pointing to Target.
+// Target is relative to the directory of the link, like 'ln -s' does it.
+type SymlinkCreation struct {
+	Path   string `json:"path"`
+	Target string `json:"target"`
 }
 
 // TestSetup defines operations to perform before running a test
@@ -72,6 +204,8 @@ type TestSetup struct {
 	CreateFiles []FileCreation `json:"createFiles"`
 	DeleteFiles []string       `json:"deleteFiles"`
 	DeleteDirs  []string       `json:"deleteDirs"`
+	// Created after the files, so links can point at them
+	Symlinks []SymlinkCreation `json:"symlinks"`
 }
 
 // TestCleanup defines operations to perform after running a test
@@ -86,12 +220,102 @@ type TestResult struct {
 	Stdout        string         `json:"stdout"`
 	Stderr        string         `json:"stderr"`
 	HttpResponses []HttpResponse `json:"httpResponses"`
+	// One entry per stdin line, in case testType is "cli_interactive"
+	Transcript []TranscriptEntry `json:"transcript,omitempty"`
+	// Processes left running by the program that had to be killed
+	ReapedProcesses []ReapedProcess `json:"reapedProcesses,omitempty"`
+	// How the program ended, output captured up to that point is kept
+	TimedOut   bool   `json:"timedOut,omitempty"`
+	Signal     string `json:"signal,omitempty"` // e.g. "SIGSEGV", if killed by a signal
+	DurationMs int64  `json:"durationMs,omitempty"`
+	DurationUs int64  `json:"durationUs,omitempty"` // the same, for timings under a millisecond
+	// Which of the test Limits stopped the program, if any
+	LimitExceeded string `json:"limitExceeded,omitempty"`
+	// Files named in Test.Collect, as the program left them
+	Files []FileArtifact `json:"files,omitempty"`
+	// What the program used while it ran, the server's whole life for HTTP tests
+	Usage *ResourceUsage `json:"usage,omitempty"`
+	// Which run of the test this is, when it was run again after a failure
+	Attempt int `json:"attempt,omitempty"`
+	// The environment the program ran with, NAME=value sorted by name. Only
+	// recorded in hermetic mode, and only the variables it fixes (HOME, LANG,
+	// LC_ALL, TZ) and those the stage or test set: passed through variables
+	// such as PATH or GOPROXY may be private and are left out.
+	Environment []string `json:"environment,omitempty"`
+	// Readiness checks of the server this test started, in case testType is
+	// "http_server"
+	ReadinessProbes []ProbeAttempt `json:"readinessProbes,omitempty"`
+	// What the server printed while the test ran, in case testType is
+	// "http_server"
+	ServerOutput *ServerOutput `json:"serverOutput,omitempty"`
+}
+
+// ServerOutput is the output of an HTTP server, the end of each stream when
+// it was too long to send whole
+type ServerOutput struct {
+	Stdout    string `json:"stdout"`
+	Stderr    string `json:"stderr"`
+	Truncated bool   `json:"truncated,omitempty"`
+}
+
+// ResourceUsage is the time and memory a program used. CPU times include
+// the children it waited for, PeakRSSKB is 0 where the OS doesn't report it.
+type ResourceUsage struct {
+	WallMs    int64 `json:"wallMs"`
+	UserMs    int64 `json:"userMs"`
+	SystemMs  int64 `json:"systemMs"`
+	PeakRSSKB int64 `json:"peakRssKb"`
+}
+
+// FileArtifact is a file collected after the test ran, before cleanup
+type FileArtifact struct {
+	Path   string `json:"path"` // as named in Test.Collect, slash separated
+	Exists bool   `json:"exists"`
+	Size   int64  `json:"size"`
+	SHA256 string `json:"sha256,omitempty"` // of the whole file, even when truncated
+	// Content is text, or base64 if Encoding is "base64"
+	Content   string `json:"content"`
+	Encoding  string `json:"encoding,omitempty"`
+	Truncated bool   `json:"truncated,omitempty"`
+	// Why the path couldn't be collected, e.g. it leads outside the test directory
+	Error string `json:"error,omitempty"`
+}
+
+// TranscriptEntry pairs a command typed into the program with its output
+type TranscriptEntry struct {
+	Command   string `json:"command"`
+	Output    string `json:"output"`
+	ElapsedMs int64  `json:"elapsedMs"`
+}
+
+// ReapedProcess is a process the runner killed when tearing down a test
+type ReapedProcess struct {
+	Pid     int    `json:"pid"`
+	Command string `json:"command"`
 }
 
 type HttpResponse struct {
 	StatusCode int               `json:"statusCode"`
 	Body       string            `json:"body"`
 	Headers    map[string]string `json:"headers"`
+	// From sending the request to reading the whole body
+	LatencyUs int64 `json:"latencyUs,omitempty"`
+	// Raw client only: the response as sent, the status line version and
+	// reason phrase, every header in order with its casing, and the ways
+	// the response breaks the protocol
+	Proto      string        `json:"proto,omitempty"`
+	Reason     string        `json:"reason,omitempty"`
+	RawHeaders []HeaderField `json:"rawHeaders,omitempty"`
+	Violations []string      `json:"violations,omitempty"`
+	// Raw client only: status lines of the interim 1xx responses sent before
+	// this one, e.g. "HTTP/1.1 100 Continue"
+	Interim []string `json:"interim,omitempty"`
+}
+
+// HeaderField is one header line of a response
+type HeaderField struct {
+	Name  string `json:"name"`
+	Value string `json:"value"`
 }
 
 type HttpRequest struct {
@@ -99,6 +323,19 @@ type HttpRequest struct {
 	Path    string            `json:"path"`
 	Headers map[string]string `json:"headers"`
 	Body    string            `json:"body"`
+	// The exact bytes to send instead, possibly malformed. Always sent with
+	// the raw client, "{port}" is replaced by the server port.
+	Raw string `json:"raw"`
+}
+
+// String describes the request by its method and path, or the first line
+// of a raw request
+func (r HttpRequest) String() string {
+	if r.Raw != "" {
+		line, _, _ := strings.Cut(r.Raw, "\n")
+		return strings.TrimRight(line, "\r")
+	}
+	return fmt.Sprintf("%s %s", r.Method, r.Path)
 }
 
 type SubmissionRequest struct {
@@ -0,0 +1,384 @@
+package cmd
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"math"
+	"os"
+	"os/signal"
+	"slices"
+	"strings"
+	"syscall"
+	"time"
+
+	"github.com/charmbracelet/lipgloss"
+	"github.com/chibuka/95/client"
+	"github.com/chibuka/95/internal/config"
+	"github.com/chibuka/95/internal/runner"
+	"github.com/chibuka/95/ui"
+	"github.com/spf13/cobra"
+)
+
+var benchCmd = &cobra.Command{
+	Use:   "bench <stage-uuid>",
+	Short: "Measure how fast your solution runs the tests of a stage",
+	Long: `Run each test of a stage many times and report how long it took and how
+much memory it used: min, median, 95th percentile and max. For HTTP tests the
+latency of every request is reported too.
+
+Nothing is submitted. Results can be saved as a baseline, later runs are
+compared against it and flag tests that got slower or bigger.
+
+Example:
+  95 bench d533f704-66aa-4dd7-ae7d-f59f505e9839 --runs 20 --save-baseline
+
+  # Compare against the saved baseline, fail on a 5% regression:
+  95 bench d533f704-66aa-4dd7-ae7d-f59f505e9839 --threshold 5`,
+	Args: cobra.ExactArgs(1),
+	RunE: func(cmd *cobra.Command, args []string) error {
+		opts, err := getBenchOptions(cmd)
+		if err != nil {
+			return err
+		}
+
+		// a regression is not a usage error
+		cmd.SilenceUsage = true
+
+		ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+		defer stop()
+		return runBench(ctx, args[0], opts)
+	},
+}
+
+// benchOptions are the command line settings of '95 bench'
+type benchOptions struct {
+	runs   int
+	warmup int
+	// save the results as the new baseline of the stage
+	saveBaseline bool
+	// how much worse than the baseline, in percent, counts as a regression
+	threshold float64
+	// sandbox, hermetic, no-network and selection, the rest is unused
+	run runOptions
+}
+
+func init() {
+	rootCmd.AddCommand(benchCmd)
+	benchCmd.Flags().IntP("runs", "n", 10, "Measured runs of each test")
+	benchCmd.Flags().Int("warmup", 1, "Runs of each test before measuring, not counted")
+	benchCmd.Flags().Bool("save-baseline", false, "Save the results as the baseline to compare later runs against")
+	benchCmd.Flags().Float64("threshold", 10, "Percent slower or bigger than the baseline that counts as a regression")
+	benchCmd.Flags().String("sandbox", "", "Run each test in a fresh temporary directory seeded from the project (copy or link)")
+	benchCmd.Flags().Lookup("sandbox").NoOptDefVal = runner.SandboxCopy
+	benchCmd.Flags().Bool("hermetic", false, "Run programs in a minimal fixed environment instead of yours")
+	benchCmd.Flags().Bool("no-network", false, "Run CLI programs without network access, only loopback (Linux)")
+	addSelectionFlags(benchCmd)
+}
+
+// getBenchOptions reads the flags of '95 bench'
+func getBenchOptions(cmd *cobra.Command) (benchOptions, error) {
+	var opts benchOptions
+	var err error
+
+	if opts.runs, err = cmd.Flags().GetInt("runs"); err != nil {
+		return opts, fmt.Errorf("failed to get runs flag: %w", err)
+	}
+	if opts.runs < 1 {
+		return opts, fmt.Errorf("--runs must be at least 1")
+	}
+
+	if opts.warmup, err = cmd.Flags().GetInt("warmup"); err != nil {
+		return opts, fmt.Errorf("failed to get warmup flag: %w", err)
+	}
+	if opts.warmup < 0 {
+		return opts, fmt.Errorf("--warmup can't be negative")
+	}
+
+	if opts.saveBaseline, err = cmd.Flags().GetBool("save-baseline"); err != nil {
+		return opts, fmt.Errorf("failed to get save-baseline flag: %w", err)
+	}
+
+	if opts.threshold, err = cmd.Flags().GetFloat64("threshold"); err != nil {
+		return opts, fmt.Errorf("failed to get threshold flag: %w", err)
+	}
+	if opts.threshold < 0 {
+		return opts, fmt.Errorf("--threshold can't be negative")
+	}
+
+	if opts.run.sandbox, err = cmd.Flags().GetString("sandbox"); err != nil {
+		return opts, fmt.Errorf("failed to get sandbox flag: %w", err)
+	}
+	if opts.run.sandbox != "" && opts.run.sandbox != runner.SandboxCopy && opts.run.sandbox != runner.SandboxLink {
+		return opts, fmt.Errorf("unknown sandbox mode %q, use --sandbox=copy or --sandbox=link", opts.run.sandbox)
+	}
+
+	if opts.run.hermetic, err = cmd.Flags().GetBool("hermetic"); err != nil {
+		return opts, fmt.Errorf("failed to get hermetic flag: %w", err)
+	}
+	if opts.run.noNetwork, err = getNoNetwork(cmd); err != nil {
+		return opts, err
+	}
+
+	if opts.run.selection, err = getSelection(cmd); err != nil {
+		return opts, err
+	}
+
+	return opts, nil
+}
+
+// benchSamples are the measurements of one test over the runs, or of one of
+// its HTTP requests
+type benchSamples struct {
+	name    string
+	timeUs  []int64
+	peakKB  []int64
+	request bool
+}
+
+// runBench benchmarks the requested stage, or the stages picked with the
+// selection flags
+func runBench(ctx context.Context, stageUuid string, opts benchOptions) error {
+	projectCfg, runCommand, projectRoot, err := loadProject()
+	if err != nil {
+		return err
+	}
+
+	globalCfg, err := config.Load()
+	if err != nil {
+		return fmt.Errorf("%w", err)
+	}
+	if globalCfg.AccessToken == "" {
+		return fmt.Errorf("not logged in. Run '95cli login' first")
+	}
+
+	cascadedConfig, err := client.FetchCascadedTests(stageUuid, globalCfg)
+	if err != nil {
+		return fmt.Errorf("failed to fetch tests: %w", err)
+	}
+	sel := opts.run.selection
+	if err := checkSelection(sel, cascadedConfig, false); err != nil {
+		return err
+	}
+
+	if projectCfg.BuildCommand != "" {
+		if err := buildProject(ctx, projectCfg); err != nil {
+			return err
+		}
+	}
+
+	baselines, err := config.LoadBenchBaselines(projectRoot)
+	if err != nil {
+		return err
+	}
+
+	fmt.Printf("\nMeasuring %d runs of each test, after %d to warm up\n\n", opts.runs, opts.warmup)
+
+	regressions := 0
+	for _, stageInfo := range cascadedConfig.StagesToRun {
+		// only the requested stage, unless stages were picked by hand
+		if sel.hasStages() {
+			if !sel.includesStage(stageInfo.StageNumber) {
+				continue
+			}
+		} else if stageInfo.StageUuid != cascadedConfig.TargetStageUuid {
+			continue
+		}
+
+		testConfig, err := client.ParseStageTests(stageInfo)
+		if err != nil {
+			return fmt.Errorf("failed to parse tests for stage %d: %w", stageInfo.StageNumber, err)
+		}
+		testConfig.Tests = sel.filterTests(testConfig.Tests)
+		if len(testConfig.Tests) == 0 {
+			continue
+		}
+
+		fmt.Printf("Stage %02d: %s\n", stageInfo.StageNumber, stageInfo.StageName)
+
+		baseline, hasBaseline := baselines.Stages[stageInfo.StageUuid]
+		entries := make(map[string]config.BenchStats)
+		for _, test := range testConfig.Tests {
+			samples, err := benchTest(ctx, test, testConfig, runCommand, projectRoot, opts)
+			if ctx.Err() != nil {
+				fmt.Println()
+				return ctx.Err()
+			}
+			if err != nil {
+				fmt.Printf("  %s\n     %s\n", test.TestName, benchBad.Render("✗ "+err.Error()))
+				continue
+			}
+
+			fmt.Printf("  %s\n", test.TestName)
+			for _, s := range samples {
+				stats := summarizeSamples(s)
+				entries[s.name] = stats
+
+				var previous *config.BenchStats
+				if base, ok := baseline.Entries[s.name]; ok && hasBaseline {
+					previous = &base
+				}
+				regressions += printBenchStats(s, stats, previous, opts.threshold)
+			}
+		}
+		fmt.Println()
+
+		if opts.saveBaseline && len(entries) > 0 {
+			baselines.Stages[stageInfo.StageUuid] = config.BenchBaseline{
+				SavedAt: time.Now(),
+				Runs:    opts.runs,
+				Entries: entries,
+			}
+		}
+	}
+
+	if opts.saveBaseline {
+		if err := config.SaveBenchBaselines(projectRoot, baselines); err != nil {
+			return err
+		}
+		fmt.Println(benchGray.Render("Saved as the baseline for future runs"))
+		fmt.Println()
+	}
+
+	if regressions > 0 {
+		return fmt.Errorf("%d measurements regressed more than %g%% from the baseline", regressions, opts.threshold)
+	}
+	return nil
+}
+
+// benchTest runs a test the warm-up and measured number of times. It returns
+// the samples of the test, followed by those of each of its HTTP requests.
+func benchTest(ctx context.Context, test client.Test, testConfig *client.TestConfig, runCommand *runner.Command,
+	projectRoot string, opts benchOptions) ([]*benchSamples, error) {
+	samples := []*benchSamples{{name: test.TestName}}
+	for i, req := range test.HttpRequests {
+		samples = append(samples, &benchSamples{
+			name:    fmt.Sprintf("%s › #%d %s", test.TestName, i+1, req),
+			request: true,
+		})
+	}
+
+	for run := 0; run < opts.warmup+opts.runs; run++ {
+		workspace, err := newTestWorkspace(projectRoot, opts.run)
+		if err != nil {
+			return nil, err
+		}
+		// every run starts a server of its own, whatever the server
+		// lifetime, so runs are measured alike
+		result, err := runSingleTest(ctx, test, testConfig, runCommand, workspace, opts.run, nil)
+		if err := workspace.Remove(); err != nil {
+			fmt.Printf("Warning: failed to remove sandbox: %v\n", err)
+		}
+		if err != nil {
+			return nil, err
+		}
+		if result.TimedOut {
+			return nil, fmt.Errorf("timed out after %ds", test.TimeoutSeconds)
+		}
+		if result.LimitExceeded != "" {
+			return nil, fmt.Errorf("stopped by the %s limit", result.LimitExceeded)
+		}
+		// a server that didn't start or answer has nothing to measure
+		if testConfig.TestType == "http_server" && len(result.HttpResponses) < len(test.HttpRequests) {
+			return nil, errors.New(result.Stderr)
+		}
+
+		if run < opts.warmup {
+			continue
+		}
+
+		// for HTTP tests the duration covers the requests, not the server start
+		whole := samples[0]
+		whole.timeUs = append(whole.timeUs, result.DurationUs)
+		if result.Usage != nil && result.Usage.PeakRSSKB > 0 {
+			whole.peakKB = append(whole.peakKB, result.Usage.PeakRSSKB)
+		}
+		for i, resp := range result.HttpResponses {
+			if i+1 < len(samples) {
+				samples[i+1].timeUs = append(samples[i+1].timeUs, resp.LatencyUs)
+			}
+		}
+	}
+
+	return samples, nil
+}
+
+// summarizeSamples computes the distribution of the samples
+func summarizeSamples(s *benchSamples) config.BenchStats {
+	return config.BenchStats{
+		TimeUs:    distribution(s.timeUs),
+		PeakRSSKB: distribution(s.peakKB),
+	}
+}
+
+// distribution returns min, median, p95 (nearest rank) and max
+func distribution(samples []int64) config.Distribution {
+	if len(samples) == 0 {
+		return config.Distribution{}
+	}
+
+	sorted := slices.Clone(samples)
+	slices.Sort(sorted)
+	n := len(sorted)
+
+	median := sorted[n/2]
+	if n%2 == 0 {
+		median = (sorted[n/2-1] + sorted[n/2]) / 2
+	}
+	p95 := sorted[int(math.Ceil(0.95*float64(n)))-1]
+
+	return config.Distribution{
+		Min:    sorted[0],
+		Median: median,
+		P95:    p95,
+		Max:    sorted[n-1],
+	}
+}
+
+var (
+	benchBad  = lipgloss.NewStyle().Foreground(lipgloss.Color("208")).Bold(true)
+	benchGood = lipgloss.NewStyle().Foreground(lipgloss.Color("10"))
+	benchGray = lipgloss.NewStyle().Foreground(lipgloss.Color("240"))
+)
+
+// printBenchStats prints the distributions of one test or request, compared
+// to the baseline when there is one. It returns the number of regressions.
+func printBenchStats(s *benchSamples, stats config.BenchStats, baseline *config.BenchStats, threshold float64) int {
+	label, indent := "time", "     "
+	if s.request {
+		// the test name is already printed above
+		_, request, _ := strings.Cut(s.name, " › ")
+		fmt.Println(indent + request)
+		label, indent = "latency", "       "
+	}
+
+	regressions := 0
+	line := func(label string, d config.Distribution, format func(int64) string, base *config.Distribution) {
+		text := fmt.Sprintf("%s%-8s min %s  median %s  p95 %s  max %s", indent, label,
+			format(d.Min), format(d.Median), format(d.P95), format(d.Max))
+		if base != nil && base.Median > 0 {
+			change := float64(d.Median-base.Median) / float64(base.Median) * 100
+			comparison := fmt.Sprintf("%+.1f%% vs baseline", change)
+			switch {
+			case change > threshold:
+				regressions++
+				text += benchBad.Render("  ▲ " + comparison)
+			case change < -threshold:
+				text += benchGood.Render("  ▼ " + comparison)
+			default:
+				text += benchGray.Render("    " + comparison)
+			}
+		}
+		fmt.Println(text)
+	}
+
+	var baseTime, baseMemory *config.Distribution
+	if baseline != nil {
+		baseTime, baseMemory = &baseline.TimeUs, &baseline.PeakRSSKB
+	}
+	line(label, stats.TimeUs, ui.FormatMicros, baseTime)
+	if len(s.peakKB) > 0 {
+		line("memory", stats.PeakRSSKB, ui.FormatKB, baseMemory)
+	}
+	return regressions
+}
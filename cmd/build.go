@@ -0,0 +1,63 @@
+package cmd
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"strings"
+
+	"github.com/chibuka/95/internal/config"
+	"github.com/chibuka/95/internal/project"
+	"github.com/chibuka/95/internal/runner"
+)
+
+// buildProject runs the project build command once before the tests, unless
+// the source tree hasn't changed since the last successful build
+func buildProject(ctx context.Context, projectCfg *config.ProjectConfig) error {
+	buildCommand, err := runner.ParseCommand(projectCfg.BuildCommand, projectCfg.Shell)
+	if err != nil {
+		return fmt.Errorf("invalid build command in project config: %w", err)
+	}
+
+	root, err := os.Getwd()
+	if err != nil {
+		return fmt.Errorf("failed to get current directory: %w", err)
+	}
+
+	sourceHash, err := project.HashTree(root)
+	if err != nil {
+		return err
+	}
+
+	lastBuild, err := config.LoadBuildState(root)
+	if err != nil {
+		return err
+	}
+	if lastBuild.SourceHash == sourceHash && lastBuild.BuildCommand == projectCfg.BuildCommand {
+		fmt.Println("✓ Build up to date")
+		return nil
+	}
+
+	fmt.Printf("Building: %s\n", projectCfg.BuildCommand)
+	output, err := runner.RunBuild(ctx, buildCommand)
+	if err != nil {
+		output = strings.TrimSpace(output)
+		if output == "" {
+			return fmt.Errorf("build failed: %w", err)
+		}
+		return fmt.Errorf("build failed: %w\n\n%s", err, output)
+	}
+	fmt.Println("✓ Build succeeded")
+
+	// Hash again after building, so outputs written next to the sources
+	// don't make the next run rebuild an unchanged project
+	sourceHash, err = project.HashTree(root)
+	if err != nil {
+		return err
+	}
+
+	return config.SaveBuildState(root, &config.BuildState{
+		BuildCommand: projectCfg.BuildCommand,
+		SourceHash:   sourceHash,
+	})
+}
@@ -0,0 +1,254 @@
+package cmd
+
+import (
+	"context"
+	"fmt"
+	"strings"
+
+	"github.com/chibuka/95/client"
+	"github.com/chibuka/95/ui/messages"
+)
+
+// maxDiffLines caps the diff shown for a flaky test
+const maxDiffLines = 40
+
+// maxDiffInput is the number of lines past which outputs are not diffed line
+// by line, only the first difference is shown
+const maxDiffInput = 2000
+
+// attempts follows the reruns of a test, to tell a flaky test from one that
+// fails the same way every time
+type attempts struct {
+	count int
+	// output of the attempt everything is compared to
+	first string
+	// set once an attempt behaved differently
+	flaky  bool
+	before int
+	after  int
+	diff   []messages.DiffLine
+}
+
+// newAttempts starts following a test from its first result
+func newAttempts(result *client.TestResult) *attempts {
+	return &attempts{count: 1, first: attemptOutput(result)}
+}
+
+// record adds the result of a rerun and reports whether its output differs
+// from the first attempt. Only the first difference is kept.
+func (a *attempts) record(result *client.TestResult) bool {
+	a.count++
+	result.Attempt = a.count
+
+	output := attemptOutput(result)
+	if output == a.first {
+		return false
+	}
+	if !a.flaky {
+		a.flaky = true
+		a.before, a.after = 1, a.count
+		a.diff = diffLines(a.first, output)
+	}
+	return true
+}
+
+// passedOnRerun flags a test the server failed and then accepted on a rerun.
+// Its output may be the same, e.g. when the failure was about timing.
+func (a *attempts) passedOnRerun() {
+	if !a.flaky {
+		a.flaky = true
+		a.before, a.after = 1, a.count
+	}
+}
+
+// message converts the attempts for the renderer, nil if the test ran once
+func (a *attempts) message() *messages.Attempts {
+	if a == nil || a.count < 2 {
+		return nil
+	}
+	return &messages.Attempts{
+		Count:  a.count,
+		Flaky:  a.flaky,
+		Before: a.before,
+		After:  a.after,
+		Diff:   a.diff,
+	}
+}
+
+// rerunFailures runs the tests the server failed again, up to
+// opts.rerunFailures times, to flag the flaky ones in stageAttempts: tests
+// whose output changed, or that the server accepted on a rerun. Only the
+// reruns are submitted, to have them checked, and the stage keeps its first
+// results and outcome: a stage that needed a rerun to pass did not pass.
+func rerunFailures(ctx context.Context, submission *client.SubmissionResult, results []client.TestResult,
+	testConfig *client.TestConfig, opts runOptions,
+	attempt func(testIdx int, test client.Test) *client.TestResult,
+	submit func([]client.TestResult) (*client.SubmissionResult, error),
+	stageAttempts []*attempts) error {
+
+	failed := failedTests(submission)
+	var rerun []int
+	for testIdx, result := range results {
+		if failed[result.TestName] {
+			rerun = append(rerun, testIdx)
+		}
+	}
+
+	for range opts.rerunFailures {
+		// the stage failed without pointing at a test, or every failed
+		// test passed on a rerun
+		if len(rerun) == 0 || ctx.Err() != nil {
+			break
+		}
+
+		var tests []client.Test
+		for _, testIdx := range rerun {
+			tests = append(tests, testConfig.Tests[testIdx])
+		}
+		rerunResults := make([]client.TestResult, len(rerun))
+		runStageTests(tests, testConfig, opts, func(i int, test client.Test) *client.TestResult {
+			return attempt(rerun[i], test)
+		}, func(i int, result *client.TestResult) {
+			testIdx := rerun[i]
+			if stageAttempts[testIdx] == nil {
+				stageAttempts[testIdx] = newAttempts(&results[testIdx])
+			}
+			stageAttempts[testIdx].record(result)
+			rerunResults[i] = *result
+		})
+
+		// never submit reruns that were cut short
+		if ctx.Err() != nil {
+			break
+		}
+		checked, err := submit(rerunResults)
+		if err != nil {
+			return err
+		}
+		stillFailed := failedTests(checked)
+		if !checked.Passed && len(stillFailed) == 0 {
+			break
+		}
+
+		var next []int
+		for _, testIdx := range rerun {
+			if stillFailed[results[testIdx].TestName] {
+				next = append(next, testIdx)
+			} else {
+				stageAttempts[testIdx].passedOnRerun()
+			}
+		}
+		rerun = next
+	}
+	return nil
+}
+
+// failedTests returns the names of the tests the server failed
+func failedTests(submission *client.SubmissionResult) map[string]bool {
+	failed := make(map[string]bool)
+	for _, failure := range submission.TestFailures {
+		failed[failure.TestName] = true
+	}
+	return failed
+}
+
+// attemptOutput is what is compared between attempts of a test: what the
+// program printed, or the status and body of each HTTP response, and how it
+// ended. HTTP headers are left out, Date and the like change every time.
+func attemptOutput(result *client.TestResult) string {
+	var out strings.Builder
+	if len(result.HttpResponses) > 0 {
+		for _, resp := range result.HttpResponses {
+			fmt.Fprintf(&out, "HTTP %d\n%s\n", resp.StatusCode, resp.Body)
+		}
+	} else {
+		out.WriteString(strings.TrimRight(result.Stdout, "\n"))
+	}
+
+	switch {
+	case result.TimedOut:
+		out.WriteString("\n[timed out]")
+	case result.Signal != "":
+		fmt.Fprintf(&out, "\n[killed by %s]", result.Signal)
+	case result.ExitCode != 0:
+		fmt.Fprintf(&out, "\n[exit code %d]", result.ExitCode)
+	}
+	return out.String()
+}
+
+// diffLines returns the changed lines between two outputs, each with one line
+// of context
+func diffLines(before, after string) []messages.DiffLine {
+	a := strings.Split(before, "\n")
+	b := strings.Split(after, "\n")
+
+	var lines []messages.DiffLine
+	if len(a) > maxDiffInput || len(b) > maxDiffInput {
+		// too long for a line by line diff, show where they part ways
+		i := 0
+		for i < len(a) && i < len(b) && a[i] == b[i] {
+			i++
+		}
+		if i < len(a) {
+			lines = append(lines, messages.DiffLine{Kind: messages.DiffRemoved, Text: a[i]})
+		}
+		if i < len(b) {
+			lines = append(lines, messages.DiffLine{Kind: messages.DiffAdded, Text: b[i]})
+		}
+		return lines
+	}
+
+	// longest common subsequence, from the end so the walk below goes forward
+	lcs := make([][]int, len(a)+1)
+	for i := range lcs {
+		lcs[i] = make([]int, len(b)+1)
+	}
+	for i := len(a) - 1; i >= 0; i-- {
+		for j := len(b) - 1; j >= 0; j-- {
+			if a[i] == b[j] {
+				lcs[i][j] = lcs[i+1][j+1] + 1
+			} else {
+				lcs[i][j] = max(lcs[i+1][j], lcs[i][j+1])
+			}
+		}
+	}
+
+	var all []messages.DiffLine
+	i, j := 0, 0
+	for i < len(a) || j < len(b) {
+		switch {
+		case i < len(a) && j < len(b) && a[i] == b[j]:
+			all = append(all, messages.DiffLine{Kind: messages.DiffSame, Text: a[i]})
+			i++
+			j++
+		case i < len(a) && (j == len(b) || lcs[i+1][j] >= lcs[i][j+1]):
+			all = append(all, messages.DiffLine{Kind: messages.DiffRemoved, Text: a[i]})
+			i++
+		default:
+			all = append(all, messages.DiffLine{Kind: messages.DiffAdded, Text: b[j]})
+			j++
+		}
+	}
+
+	// keep changes and the lines right around them, "…" marks a gap
+	gap := messages.DiffLine{Kind: messages.DiffSame, Text: "…"}
+	lastKept := -1
+	for k, line := range all {
+		near := line.Kind != messages.DiffSame ||
+			(k > 0 && all[k-1].Kind != messages.DiffSame) ||
+			(k+1 < len(all) && all[k+1].Kind != messages.DiffSame)
+		if !near {
+			continue
+		}
+		if len(lines) >= maxDiffLines {
+			lines = append(lines, gap)
+			break
+		}
+		if lastKept >= 0 && k > lastKept+1 {
+			lines = append(lines, gap)
+		}
+		lines = append(lines, line)
+		lastKept = k
+	}
+	return lines
+}
@@ -6,18 +6,139 @@ import (
 	"strings"
 
 	"github.com/chibuka/95/client"
+	"github.com/chibuka/95/ui/messages"
 )
 
 // getTestInput returns the input to display for a test
 func getTestInput(test client.Test) string {
 	if len(test.HttpRequests) > 0 {
 		// For HTTP tests, show the first request
-		req := test.HttpRequests[0]
-		return fmt.Sprintf("%s %s", req.Method, req.Path)
+		return test.HttpRequests[0].String()
 	}
 	return test.Stdin
 }
 
+// getInteractiveConfig returns how input is fed to the program for a CLI test,
+// per-test settings win over the stage settings
+func getInteractiveConfig(test client.Test, testConfig *client.TestConfig) client.InteractiveConfig {
+	cfg := client.InteractiveConfig{Mode: client.InputModePipe}
+	for _, override := range []*client.InteractiveConfig{testConfig.Interactive, test.Interactive} {
+		if override == nil {
+			continue
+		}
+		if override.Mode != "" {
+			cfg.Mode = override.Mode
+		}
+		if override.Prompt != "" {
+			cfg.Prompt = override.Prompt
+		}
+		if override.QuietMs > 0 {
+			cfg.QuietMs = override.QuietMs
+		}
+	}
+	return cfg
+}
+
+// getLimits returns the resource limits of a test, per-test limits win over
+// the stage limits field by field
+func getLimits(test client.Test, testConfig *client.TestConfig) client.Limits {
+	var limits client.Limits
+	for _, override := range []*client.Limits{testConfig.Limits, test.Limits} {
+		if override == nil {
+			continue
+		}
+		if override.MemoryMB > 0 {
+			limits.MemoryMB = override.MemoryMB
+		}
+		if override.CPUSeconds > 0 {
+			limits.CPUSeconds = override.CPUSeconds
+		}
+		if override.MaxProcesses > 0 {
+			limits.MaxProcesses = override.MaxProcesses
+		}
+		if override.MaxOpenFiles > 0 {
+			limits.MaxOpenFiles = override.MaxOpenFiles
+		}
+		if override.MaxOutputKB > 0 {
+			limits.MaxOutputKB = override.MaxOutputKB
+		}
+	}
+	return limits
+}
+
+// resolveTestMsg builds the renderer message for a finished test
+func resolveTestMsg(stepIdx, testIdx int, passed *bool, stdin string, testType string, result *client.TestResult) messages.ResolveTestMsg {
+	var reaped []string
+	for _, p := range result.ReapedProcesses {
+		reaped = append(reaped, fmt.Sprintf("%d %s", p.Pid, p.Command))
+	}
+
+	return messages.ResolveTestMsg{
+		StepIndex:  stepIdx,
+		TestIndex:  testIdx,
+		Passed:     passed,
+		Stdin:      stdin,
+		Stdout:     formatTestOutput(testType, result),
+		Stderr:     result.Stderr,
+		ExitCode:   result.ExitCode,
+		Transcript: getTranscript(result),
+		TimedOut:   result.TimedOut,
+		Signal:     result.Signal,
+		DurationMs: result.DurationMs,
+		Reaped:     reaped,
+		Files:      getFiles(result),
+		Limit:      result.LimitExceeded,
+		Usage:      getUsage(result),
+	}
+}
+
+// getUsage converts the resource usage of a test for the renderer
+func getUsage(result *client.TestResult) *messages.ResourceUsage {
+	if result.Usage == nil {
+		return nil
+	}
+	return &messages.ResourceUsage{
+		WallMs:    result.Usage.WallMs,
+		CPUMs:     result.Usage.UserMs + result.Usage.SystemMs,
+		PeakRSSKB: result.Usage.PeakRSSKB,
+	}
+}
+
+// getFiles converts collected files for the renderer, binary content is
+// summarized by its size instead of shown
+func getFiles(result *client.TestResult) []messages.FileArtifact {
+	var files []messages.FileArtifact
+	for _, file := range result.Files {
+		artifact := messages.FileArtifact{
+			Path:      file.Path,
+			Exists:    file.Exists,
+			Size:      file.Size,
+			Truncated: file.Truncated,
+			Error:     file.Error,
+		}
+		if file.Encoding == client.EncodingBase64 {
+			artifact.Binary = true
+		} else {
+			artifact.Content = file.Content
+		}
+		files = append(files, artifact)
+	}
+	return files
+}
+
+// getTranscript converts a test transcript for the renderer
+func getTranscript(result *client.TestResult) []messages.TranscriptEntry {
+	var transcript []messages.TranscriptEntry
+	for _, entry := range result.Transcript {
+		transcript = append(transcript, messages.TranscriptEntry{
+			Command:   entry.Command,
+			Output:    entry.Output,
+			ElapsedMs: entry.ElapsedMs,
+		})
+	}
+	return transcript
+}
+
 // formatTestOutput formats the test result for display
 func formatTestOutput(testType string, result *client.TestResult) string {
 	if testType == "http_server" && len(result.HttpResponses) > 0 {
@@ -26,14 +147,31 @@ func formatTestOutput(testType string, result *client.TestResult) string {
 			if i > 0 {
 				output.WriteString("\n---\n")
 			}
-			output.WriteString(fmt.Sprintf("HTTP %d\n", resp.StatusCode))
-			for k, v := range resp.Headers {
-				output.WriteString(fmt.Sprintf("%s: %s\n", k, v))
+			// raw responses are shown as sent, headers in order
+			if resp.Proto != "" {
+				for _, line := range resp.Interim {
+					output.WriteString(line + "\n")
+				}
+				output.WriteString(fmt.Sprintf("%s %d %s\n", resp.Proto, resp.StatusCode, resp.Reason))
+				for _, field := range resp.RawHeaders {
+					output.WriteString(fmt.Sprintf("%s: %s\n", field.Name, field.Value))
+				}
+			} else {
+				output.WriteString(fmt.Sprintf("HTTP %d\n", resp.StatusCode))
+				for k, v := range resp.Headers {
+					output.WriteString(fmt.Sprintf("%s: %s\n", k, v))
+				}
 			}
 			if resp.Body != "" {
 				output.WriteString("\n")
 				output.WriteString(resp.Body)
 			}
+			if len(resp.Violations) > 0 {
+				output.WriteString("\n\nProtocol violations:\n")
+				for _, violation := range resp.Violations {
+					output.WriteString(fmt.Sprintf("  - %s\n", violation))
+				}
+			}
 		}
 		return output.String()
 	}
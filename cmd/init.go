@@ -4,6 +4,7 @@ import (
 	"fmt"
 
 	"github.com/chibuka/95/internal/config"
+	"github.com/chibuka/95/internal/runner"
 	"github.com/spf13/cobra"
 )
 
@@ -19,6 +20,13 @@ Examples:
   95 init --cmd "node index.js"
   95 init --cmd "go run main.go"
   95 init --cmd "./my-binary"
+  95 init --cmd 'RUST_LOG=debug cargo run --release'
+
+  # Shell features (&&, pipes, $VARS) need --shell:
+  95 init --shell --cmd "make && ./app"
+
+  # Compile once before the tests instead of on every test:
+  95 init --cmd "go run ." --build "go build -o app ." --artifact "./app"
 
   # Shorthand (positional argument):
   95 init "python main.py"`,
@@ -40,17 +48,62 @@ Examples:
 			return fmt.Errorf("run command cannot be empty. Use: 95 init --cmd \"<command>\" or 95 init \"<command>\"")
 		}
 
+		useShell, err := cmd.Flags().GetBool("shell")
+		if err != nil {
+			return fmt.Errorf("failed to get shell flag: %w", err)
+		}
+
+		buildCommand, err := cmd.Flags().GetString("build")
+		if err != nil {
+			return fmt.Errorf("failed to get build flag: %w", err)
+		}
+
+		artifactCommand, err := cmd.Flags().GetString("artifact")
+		if err != nil {
+			return fmt.Errorf("failed to get artifact flag: %w", err)
+		}
+
+		// Make sure the commands can be run before saving them
+		if _, err := runner.ParseCommand(runCommand, useShell); err != nil {
+			return fmt.Errorf("invalid run command: %w", err)
+		}
+		if buildCommand != "" {
+			if _, err := runner.ParseCommand(buildCommand, useShell); err != nil {
+				return fmt.Errorf("invalid build command: %w", err)
+			}
+		}
+		if artifactCommand != "" {
+			if _, err := runner.ParseCommand(artifactCommand, useShell); err != nil {
+				return fmt.Errorf("invalid artifact command: %w", err)
+			}
+		}
+
 		// Detect language from run command
 		language := config.DetectLanguage(runCommand)
 
 		// Save project config
-		err := config.SaveProjectConfig(runCommand, language)
+		err = config.SaveProjectConfig(&config.ProjectConfig{
+			RunCommand:      runCommand,
+			Language:        language,
+			Shell:           useShell,
+			BuildCommand:    buildCommand,
+			ArtifactCommand: artifactCommand,
+		})
 		if err != nil {
 			return fmt.Errorf("failed to save project config: %w", err)
 		}
 
 		fmt.Printf("✓ Project initialized!\n")
 		fmt.Printf("  Run command: %s\n", runCommand)
+		if useShell {
+			fmt.Printf("  Runs through: sh -c\n")
+		}
+		if buildCommand != "" {
+			fmt.Printf("  Build command: %s\n", buildCommand)
+		}
+		if artifactCommand != "" {
+			fmt.Printf("  Tests run: %s\n", artifactCommand)
+		}
 		fmt.Printf("  Language: %s\n", language)
 		fmt.Println("\nTip: Make sure your command includes the entry point file in case you runCommand needs it (e.g., 'python main.py')")
 		return nil
@@ -60,4 +113,7 @@ Examples:
 func init() {
 	rootCmd.AddCommand(initCmd)
 	initCmd.Flags().String("cmd", "", "Command to run your program (e.g., 'python main.py')")
+	initCmd.Flags().String("build", "", "Command to compile your program once before the tests (e.g., 'go build -o app .')")
+	initCmd.Flags().String("artifact", "", "Command to run the built program in tests (e.g., './app')")
+	initCmd.Flags().Bool("shell", false, "Run the command through sh, for &&, pipes and variable expansion")
 }
@@ -0,0 +1,101 @@
+package cmd
+
+import (
+	"sync"
+
+	"github.com/chibuka/95/client"
+)
+
+// testLocks keeps tests that can't share the machine from overlapping when
+// a stage runs on several workers
+type testLocks struct {
+	// setup and cleanup write to the project directory, such tests run alone
+	files sync.RWMutex
+	// a server on a fixed port can only be started once at a time
+	port sync.Mutex
+}
+
+// acquire takes the locks a test needs and returns the function releasing them
+func (l *testLocks) acquire(test client.Test, testConfig *client.TestConfig, opts runOptions) func() {
+	touchesFiles := test.Setup != nil || test.Cleanup != nil || len(test.Collect) > 0
+	if touchesFiles && opts.sandbox == "" {
+		l.files.Lock()
+	} else {
+		l.files.RLock()
+	}
+
+	usesPort := testConfig.TestType == "http_server" &&
+		(testConfig.ServerConfig == nil || !testConfig.ServerConfig.DynamicPort)
+	if usesPort {
+		l.port.Lock()
+	}
+
+	return func() {
+		if usesPort {
+			l.port.Unlock()
+		}
+		if touchesFiles && opts.sandbox == "" {
+			l.files.Unlock()
+		} else {
+			l.files.RUnlock()
+		}
+	}
+}
+
+// runStageTests runs the tests of a stage on up to jobs workers. report is
+// called on the calling goroutine with each result in test order, as soon as
+// that test and all the ones before it are done, so the output and the
+// submitted results are the same as running them one after another.
+func runStageTests(tests []client.Test, testConfig *client.TestConfig, opts runOptions,
+	run func(testIdx int, test client.Test) *client.TestResult,
+	report func(testIdx int, result *client.TestResult)) {
+
+	type finished struct {
+		testIdx int
+		result  *client.TestResult
+	}
+
+	jobs := make(chan int)
+	results := make(chan finished)
+	var locks testLocks
+
+	workers := min(opts.jobs, len(tests))
+	// tests sharing a server may depend on what the earlier ones did to it
+	if testConfig.ServerConfig != nil && testConfig.ServerConfig.Lifetime == client.ServerLifetimeStage {
+		workers = 1
+	}
+	var wg sync.WaitGroup
+	for range workers {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for testIdx := range jobs {
+				release := locks.acquire(tests[testIdx], testConfig, opts)
+				result := run(testIdx, tests[testIdx])
+				release()
+				results <- finished{testIdx, result}
+			}
+		}()
+	}
+
+	go func() {
+		for testIdx := range tests {
+			jobs <- testIdx
+		}
+		close(jobs)
+		wg.Wait()
+		close(results)
+	}()
+
+	// hold back results until every earlier test has been reported
+	pending := make(map[int]*client.TestResult)
+	next := 0
+	for f := range results {
+		pending[f.testIdx] = f.result
+		for pending[next] != nil {
+			report(next, pending[next])
+			delete(pending, next)
+			next++
+		}
+	}
+}
@@ -25,6 +25,9 @@ Quick Start:
   4. Submit solution:   95 run <stage-uuid>
 
 For more information, visit: https://95ninefive.dev`,
+	PersistentPreRun: func(cmd *cobra.Command, args []string) {
+		config.Init()
+	},
 }
 
 func Execute() {
@@ -33,7 +36,3 @@ func Execute() {
 		os.Exit(1)
 	}
 }
-
-func init() {
-	config.Init()
-}
@@ -1,6 +1,11 @@
 package cmd
 
 import (
+	"context"
+	"os"
+	"os/signal"
+	"syscall"
+
 	"github.com/spf13/cobra"
 )
 
@@ -19,10 +24,26 @@ Tip: Use '95 test' first to validate locally before submitting.`,
 	Args: cobra.ExactArgs(1),
 	RunE: func(cmd *cobra.Command, args []string) error {
 		stageUuid := args[0]
-		return runOrTest(stageUuid, true)
+		opts, err := getRunOptions(cmd)
+		if err != nil {
+			return err
+		}
+		if opts.watch {
+			return watchAndRun(stageUuid, true, opts)
+		}
+		// an interrupted run is not a usage error
+		cmd.SilenceUsage = true
+
+		// Ctrl-C cancels the run, which stops the program under test and
+		// its children instead of leaving them running
+		ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+		defer stop()
+		_, err = runOrTest(ctx, stageUuid, true, opts)
+		return err
 	},
 }
 
 func init() {
 	rootCmd.AddCommand(runCmd)
+	addRunFlags(runCmd)
 }
@@ -1,40 +1,175 @@
 package cmd
 
 import (
+	"context"
 	"fmt"
+	"os"
+	"slices"
 
 	"github.com/chibuka/95/client"
 	"github.com/chibuka/95/internal/config"
 	"github.com/chibuka/95/internal/runner"
 	"github.com/chibuka/95/ui"
 	"github.com/chibuka/95/ui/messages"
+	"github.com/spf13/cobra"
 )
 
-func runOrTest(stageUuid string, isSubmit bool) error {
-	// Load project config to get run command
-	projectCfg, err := config.LoadProjectConfig()
-	if err != nil {
-		return fmt.Errorf("failed to load project config: %w", err)
+// runOptions are the command line settings shared by '95 test' and '95 run'
+type runOptions struct {
+	// "" runs tests in the project directory, otherwise a sandbox mode
+	sandbox string
+	// keep sandboxes after the run instead of deleting them
+	keep bool
+	// let setup and cleanup delete files tracked by git
+	allowTrackedDeletes bool
+	// how many tests of a stage run at the same time
+	jobs int
+	// run stages even if they were verified for the same sources before
+	full bool
+	// re-run whenever project files change
+	watch bool
+	// stages and tests to run, everything by default
+	selection selection
+	// how many more times a failed test runs, to tell flaky tests apart
+	rerunFailures int
+	// run programs in a minimal fixed environment
+	hermetic bool
+	// run CLI programs without network access, only loopback
+	noNetwork bool
+	// called once the project is built, with the hash of the sources the
+	// run tests (watch mode only)
+	sourceReady func(sourceHash string)
+}
+
+// runSummary is the outcome of one run of the cascade
+type runSummary struct {
+	totalTests  int
+	totalPassed int
+	// false in test mode, where nothing is validated
+	validated bool
+	passed    bool
+}
+
+// addRunFlags registers the flags shared by '95 test' and '95 run'
+func addRunFlags(cmd *cobra.Command) {
+	cmd.Flags().String("sandbox", "", "Run each test in a fresh temporary directory seeded from the project (copy or link)")
+	cmd.Flags().Lookup("sandbox").NoOptDefVal = runner.SandboxCopy
+	cmd.Flags().Bool("keep", false, "Keep sandbox directories after the run for inspection")
+	cmd.Flags().Bool("allow-tracked-deletes", false, "Let test setup and cleanup delete files tracked by git")
+	cmd.Flags().IntP("jobs", "j", 1, "Run up to this many tests of a stage at the same time")
+	cmd.Flags().Bool("full", false, "Run every stage, even those already verified for the current sources")
+	cmd.Flags().Bool("watch", false, "Re-run whenever project files change")
+	cmd.Flags().Int("rerun-failures", 0, "Run failed tests up to this many more times and flag flaky ones")
+	cmd.Flags().Bool("hermetic", false, "Run programs in a minimal fixed environment instead of yours")
+	cmd.Flags().Bool("no-network", false, "Run CLI programs without network access, only loopback (Linux)")
+	addSelectionFlags(cmd)
+}
+
+// getRunOptions reads the flags registered by addRunFlags
+func getRunOptions(cmd *cobra.Command) (runOptions, error) {
+	var opts runOptions
+	var err error
+
+	if opts.sandbox, err = cmd.Flags().GetString("sandbox"); err != nil {
+		return opts, fmt.Errorf("failed to get sandbox flag: %w", err)
+	}
+	if opts.sandbox != "" && opts.sandbox != runner.SandboxCopy && opts.sandbox != runner.SandboxLink {
+		return opts, fmt.Errorf("unknown sandbox mode %q, use --sandbox=copy or --sandbox=link", opts.sandbox)
 	}
 
-	if projectCfg.RunCommand == "" {
-		return fmt.Errorf("no run command found. Run '95cli init --cmd \"your command\"' first")
+	if opts.keep, err = cmd.Flags().GetBool("keep"); err != nil {
+		return opts, fmt.Errorf("failed to get keep flag: %w", err)
+	}
+	if opts.keep && opts.sandbox == "" {
+		return opts, fmt.Errorf("--keep only applies to sandboxes, add --sandbox")
+	}
+
+	if opts.allowTrackedDeletes, err = cmd.Flags().GetBool("allow-tracked-deletes"); err != nil {
+		return opts, fmt.Errorf("failed to get allow-tracked-deletes flag: %w", err)
+	}
+
+	if opts.jobs, err = cmd.Flags().GetInt("jobs"); err != nil {
+		return opts, fmt.Errorf("failed to get jobs flag: %w", err)
+	}
+	if opts.jobs < 1 {
+		return opts, fmt.Errorf("--jobs must be at least 1")
+	}
+
+	if opts.full, err = cmd.Flags().GetBool("full"); err != nil {
+		return opts, fmt.Errorf("failed to get full flag: %w", err)
+	}
+
+	if opts.watch, err = cmd.Flags().GetBool("watch"); err != nil {
+		return opts, fmt.Errorf("failed to get watch flag: %w", err)
+	}
+	if opts.watch && opts.keep {
+		return opts, fmt.Errorf("--keep can't be combined with --watch")
+	}
+
+	if opts.selection, err = getSelection(cmd); err != nil {
+		return opts, err
+	}
+
+	if opts.rerunFailures, err = cmd.Flags().GetInt("rerun-failures"); err != nil {
+		return opts, fmt.Errorf("failed to get rerun-failures flag: %w", err)
+	}
+	if opts.rerunFailures < 0 {
+		return opts, fmt.Errorf("--rerun-failures can't be negative")
+	}
+
+	if opts.hermetic, err = cmd.Flags().GetBool("hermetic"); err != nil {
+		return opts, fmt.Errorf("failed to get hermetic flag: %w", err)
+	}
+
+	if opts.noNetwork, err = getNoNetwork(cmd); err != nil {
+		return opts, err
+	}
+
+	return opts, nil
+}
+
+// runOrTest runs the cascade of stages up to stageUuid, and submits the
+// results when isSubmit is set. Cancelling ctx stops the run.
+func runOrTest(ctx context.Context, stageUuid string, isSubmit bool, opts runOptions) (*runSummary, error) {
+	projectCfg, runCommand, projectRoot, err := loadProject()
+	if err != nil {
+		return nil, err
 	}
 
 	// Load global config to get auth
 	globalCfg, err := config.Load()
 	if err != nil {
-		return fmt.Errorf("%w", err)
+		return nil, fmt.Errorf("%w", err)
 	}
 
 	if globalCfg.AccessToken == "" {
-		return fmt.Errorf("not logged in. Run '95cli login' first")
+		return nil, fmt.Errorf("not logged in. Run '95cli login' first")
 	}
 
 	// Fetch cascaded tests (stages 1..X) from backend
 	cascadedConfig, err := client.FetchCascadedTests(stageUuid, globalCfg)
 	if err != nil {
-		return fmt.Errorf("failed to fetch tests: %w", err)
+		return nil, fmt.Errorf("failed to fetch tests: %w", err)
+	}
+
+	if err := checkSelection(opts.selection, cascadedConfig, isSubmit); err != nil {
+		return nil, err
+	}
+
+	// Build once up front, so compile time doesn't count against test timeouts
+	if projectCfg.BuildCommand != "" {
+		if err := buildProject(ctx, projectCfg); err != nil {
+			return nil, err
+		}
+	}
+
+	// Hashed after the build, like the build cache does
+	verification, err := loadVerification(projectRoot, projectCfg)
+	if err != nil {
+		return nil, err
+	}
+	if opts.sourceReady != nil {
+		opts.sourceReady(verification.verified.SourceHash)
 	}
 
 	// Start renderer
@@ -46,22 +181,47 @@ func runOrTest(stageUuid string, isSubmit bool) error {
 	totalPassed := 0
 
 	var lastSubmissionResult *client.SubmissionResult
+	var keptSandboxes []string
 	if isSubmit {
 		fmt.Printf("Running stages 0 through %d (%d total stages)\n\n",
 			cascadedConfig.TargetStageNumber, len(cascadedConfig.StagesToRun))
 	}
 
-	for stepIdx, stageInfo := range cascadedConfig.StagesToRun {
+	// index of the stage in the renderer, stages outside the selection
+	// aren't shown at all
+	stepIdx := -1
+	for _, stageInfo := range cascadedConfig.StagesToRun {
+		if ctx.Err() != nil {
+			break
+		}
+		if !opts.selection.includesStage(stageInfo.StageNumber) {
+			continue
+		}
+		if canSkipStage(stageInfo, cascadedConfig, verification, isSubmit, opts) {
+			stepIdx++
+			ch <- messages.SkipStepMsg{
+				StageNumber: stageInfo.StageNumber,
+				StageName:   stageInfo.StageName,
+			}
+			continue
+		}
+
 		// Parse test config for this stage
 		testConfig, err := client.ParseStageTests(stageInfo)
 		if err != nil {
 			done(false, 0, 0, fmt.Sprintf("Failed to parse tests for stage %d: %v", stageInfo.StageNumber, err))
-			return nil
+			return &runSummary{validated: isSubmit}, nil
+		}
+
+		testConfig.Tests = opts.selection.filterTests(testConfig.Tests)
+		if len(testConfig.Tests) == 0 {
+			continue
 		}
 
 		totalTests += len(testConfig.Tests)
 
 		// Send start stage message
+		stepIdx++
 		ch <- messages.StartStepMsg{
 			StageNumber: stageInfo.StageNumber,
 			StageName:   stageInfo.StageName,
@@ -70,58 +230,118 @@ func runOrTest(stageUuid string, isSubmit bool) error {
 		var results []client.TestResult
 		passedCount := 0
 
-		for testIdx, test := range testConfig.Tests {
-			// Start test
+		// Announce every test up front, results are reported in this order
+		// even when several tests run at once
+		for _, test := range testConfig.Tests {
 			ch <- messages.StartTestMsg{
 				TestName: test.TestName,
 				Stdin:    getTestInput(test),
 			}
+		}
 
-			result, err := runSingleTest(test, testConfig, projectCfg.RunCommand)
+		// the sandbox of every attempt of a test, reruns included
+		sandboxDirs := make([][]string, len(testConfig.Tests))
+		stageAttempts := make([]*attempts, len(testConfig.Tests))
+		// nil unless the tests of the stage share one server
+		server := newStageServer(testConfig, runCommand, projectRoot, opts)
+		attemptTest := func(testIdx int, test client.Test) *client.TestResult {
+			if ctx.Err() != nil {
+				return &client.TestResult{TestName: test.TestName, ExitCode: -1, Stderr: "run cancelled"}
+			}
 
-			if err != nil {
-				ch <- messages.ResolveTestMsg{
-					StepIndex: stepIdx,
-					TestIndex: testIdx,
-					Passed:    nil,
-					Stdin:     getTestInput(test),
-					Stdout:    "",
-					Stderr:    err.Error(),
-					ExitCode:  -1,
+			var result *client.TestResult
+			var workspace *runner.Workspace
+			var err error
+			if server != nil {
+				workspace, err = server.workspaceFor(test, testOptions(test, testConfig, opts))
+			} else {
+				workspace, err = newTestWorkspace(projectRoot, opts)
+			}
+			if err == nil {
+				result, err = runSingleTest(ctx, test, testConfig, runCommand, workspace, opts, server.target())
+
+				// the workspace of a stage server goes with the server, its
+				// tests and their reruns may share it
+				if opts.keep {
+					if !slices.Contains(sandboxDirs[testIdx], workspace.Dir) {
+						sandboxDirs[testIdx] = append(sandboxDirs[testIdx], workspace.Dir)
+					}
+				} else if server == nil {
+					if err := workspace.Remove(); err != nil {
+						fmt.Printf("Warning: failed to remove sandbox: %v\n", err)
+					}
 				}
+			}
+
+			if err != nil {
 				result = &client.TestResult{
-					TestName: test.TestName,
 					ExitCode: -1,
 					Stderr:   err.Error(),
 				}
-			} else {
-				stdout := formatTestOutput(testConfig.TestType, result)
-				ch <- messages.ResolveTestMsg{
-					StepIndex: stepIdx,
-					TestIndex: testIdx,
-					Passed:    nil, // Will be determined by backend validation if isSubmit
-					Stdin:     getTestInput(test),
-					Stdout:    stdout,
-					Stderr:    result.Stderr,
-					ExitCode:  result.ExitCode,
+			}
+			result.TestName = test.TestName
+			return result
+		}
+		runTest := func(testIdx int, test client.Test) *client.TestResult {
+			result := attemptTest(testIdx, test)
+
+			// nothing tells whether a test failed in test mode, so every test
+			// is rerun looking for output that changes
+			if !isSubmit && opts.rerunFailures > 0 {
+				stageAttempts[testIdx] = newAttempts(result)
+				for range opts.rerunFailures {
+					if ctx.Err() != nil || stageAttempts[testIdx].record(attemptTest(testIdx, test)) {
+						break
+					}
 				}
-				result.TestName = test.TestName
 			}
+			return result
+		}
+
+		runStageTests(testConfig.Tests, testConfig, opts, runTest, func(testIdx int, result *client.TestResult) {
+			test := testConfig.Tests[testIdx]
+			// Passed will be determined by backend validation if isSubmit
+			msg := resolveTestMsg(stepIdx, testIdx, nil, getTestInput(test), testConfig.TestType, result)
+			msg.Attempts = stageAttempts[testIdx].message()
+			ch <- msg
 			results = append(results, *result)
+		})
+
+		// failed tests may run again after the submission, until then the
+		// server stays up
+		if !isSubmit || ctx.Err() != nil {
+			server.stop()
+		}
+		if !isSubmit {
+			keptSandboxes = append(keptSandboxes, describeSandboxes(stageInfo.StageNumber, testConfig.Tests, sandboxDirs)...)
+		}
+
+		// Never submit a stage that was cut short
+		if ctx.Err() != nil {
+			break
 		}
 
 		if isSubmit {
 			// Submit results for this stage to backend for validation
-			submissionResult, err := client.SubmitResults(
-				stageInfo.StageUuid,
-				projectCfg.Language,
-				globalCfg,
-				results,
-				&cascadedConfig.TargetStageNumber,
-			)
+			submit := func(results []client.TestResult) (*client.SubmissionResult, error) {
+				return client.SubmitResults(
+					stageInfo.StageUuid,
+					projectCfg.Language,
+					globalCfg,
+					results,
+					&cascadedConfig.TargetStageNumber,
+				)
+			}
+			submissionResult, err := submit(results)
+			// reruns only flag flaky tests, the stage is graded on its first run
+			if err == nil && !submissionResult.Passed && opts.rerunFailures > 0 {
+				err = rerunFailures(ctx, submissionResult, results, testConfig, opts, attemptTest, submit, stageAttempts)
+			}
+			server.stop()
+			keptSandboxes = append(keptSandboxes, describeSandboxes(stageInfo.StageNumber, testConfig.Tests, sandboxDirs)...)
 			if err != nil {
 				done(false, totalTests, totalPassed, fmt.Sprintf("Submission failed for stage %d: %v", stageInfo.StageNumber, err))
-				return nil
+				return &runSummary{totalTests: totalTests, totalPassed: totalPassed, validated: true}, nil
 			}
 
 			lastSubmissionResult = submissionResult
@@ -142,37 +362,31 @@ func runOrTest(stageUuid string, isSubmit bool) error {
 					if passed {
 						passedCount++
 					}
-					stdout := formatTestOutput(testConfig.TestType, &testResult)
-					ch <- messages.ResolveTestMsg{
-						StepIndex: stepIdx,
-						TestIndex: testIdx,
-						Passed:    &passed,
-						Stdin:     testConfig.Tests[testIdx].Stdin,
-						Stdout:    stdout,
-						Stderr:    testResult.Stderr,
-						ExitCode:  testResult.ExitCode,
-					}
+					msg := resolveTestMsg(stepIdx, testIdx, &passed, testConfig.Tests[testIdx].Stdin, testConfig.TestType, &testResult)
+					msg.Attempts = stageAttempts[testIdx].message()
+					ch <- msg
 				}
 			} else {
 				// All tests passed
 				passedCount = len(results)
 				for testIdx, testResult := range results {
 					passed := true
-					stdout := formatTestOutput(testConfig.TestType, &testResult)
-					ch <- messages.ResolveTestMsg{
-						StepIndex: stepIdx,
-						TestIndex: testIdx,
-						Passed:    &passed,
-						Stdin:     testConfig.Tests[testIdx].Stdin,
-						Stdout:    stdout,
-						Stderr:    testResult.Stderr,
-						ExitCode:  testResult.ExitCode,
-					}
+					msg := resolveTestMsg(stepIdx, testIdx, &passed, testConfig.Tests[testIdx].Stdin, testConfig.TestType, &testResult)
+					msg.Attempts = stageAttempts[testIdx].message()
+					ch <- msg
 				}
 			}
 
 			totalPassed += passedCount
 
+			// a stage only counts as verified when all of its tests ran
+			if submissionResult.Passed && opts.selection.match == nil {
+				verification.markVerified(stageInfo)
+				if err := verification.save(); err != nil {
+					fmt.Printf("Warning: failed to save verified stages: %v\n", err)
+				}
+			}
+
 			// Mark step as complete with backend validation result
 			ch <- messages.ResolveStepMsg{
 				Index:  stepIdx,
@@ -188,6 +402,23 @@ func runOrTest(stageUuid string, isSubmit bool) error {
 		}
 	}
 
+	summary := &runSummary{
+		totalTests:  totalTests,
+		totalPassed: totalPassed,
+		validated:   isSubmit,
+		passed:      lastSubmissionResult != nil && lastSubmissionResult.Passed,
+	}
+
+	if ctx.Err() != nil {
+		done(false, totalTests, totalPassed, "")
+		return summary, ctx.Err()
+	}
+
+	if totalTests == 0 && opts.selection.match != nil {
+		done(false, 0, 0, "Nothing to run for "+opts.selection.describe())
+		return summary, nil
+	}
+
 	if isSubmit {
 		if lastSubmissionResult != nil {
 			done(
@@ -203,19 +434,153 @@ func runOrTest(stageUuid string, isSubmit bool) error {
 		done(true, totalTests, 0, fmt.Sprintf("Run '95 run %s' to submit your results", stageUuid))
 	}
 
+	if len(keptSandboxes) > 0 {
+		fmt.Println("Kept sandboxes:")
+		for _, sandbox := range keptSandboxes {
+			fmt.Printf("  %s\n", sandbox)
+		}
+		fmt.Println()
+	}
+
+	return summary, nil
+}
+
+// loadProject reads the project config in the current directory and the
+// command tests run
+func loadProject() (*config.ProjectConfig, *runner.Command, string, error) {
+	// Load project config to get run command
+	projectCfg, err := config.LoadProjectConfig()
+	if err != nil {
+		return nil, nil, "", fmt.Errorf("failed to load project config: %w", err)
+	}
+
+	if projectCfg.RunCommand == "" {
+		return nil, nil, "", fmt.Errorf("no run command found. Run '95cli init --cmd \"your command\"' first")
+	}
+
+	runCommand, err := runner.ParseCommand(projectCfg.TestCommand(), projectCfg.Shell)
+	if err != nil {
+		return nil, nil, "", fmt.Errorf("invalid run command in project config: %w", err)
+	}
+
+	projectRoot, err := os.Getwd()
+	if err != nil {
+		return nil, nil, "", fmt.Errorf("failed to get current directory: %w", err)
+	}
+
+	return projectCfg, runCommand, projectRoot, nil
+}
+
+// canSkipStage reports whether a stage of the cascade already passed for the
+// current sources and doesn't need to run again. The requested stage always
+// runs. When submitting, only stages below the target are skipped: the
+// server only records progress for the target stage.
+func canSkipStage(stageInfo client.StageTestInfo, cascadedConfig *client.CascadedTestConfig,
+	verification *verification, isSubmit bool, opts runOptions) bool {
+	// stages and tests picked by hand always run
+	if opts.full || opts.selection.isSet() || stageInfo.StageUuid == cascadedConfig.TargetStageUuid {
+		return false
+	}
+	if isSubmit && stageInfo.StageNumber >= cascadedConfig.TargetStageNumber {
+		return false
+	}
+	return verification.isVerified(stageInfo)
+}
+
+// checkSelection makes sure stage and test selections make sense for this
+// cascade. Submitting a selection leaves required stages out, so it is only
+// allowed when the server accepts partial runs.
+func checkSelection(sel selection, cascadedConfig *client.CascadedTestConfig, isSubmit bool) error {
+	if !sel.isSet() {
+		return nil
+	}
+
+	if isSubmit && !cascadedConfig.AllowPartialRuns {
+		return fmt.Errorf("'95 run' has to run every stage up to stage %d, this server doesn't accept %s\n\n→ Use '95 test' to run a selection",
+			cascadedConfig.TargetStageNumber, sel.describe())
+	}
+
+	if sel.hasStages() {
+		for _, stageInfo := range cascadedConfig.StagesToRun {
+			if sel.includesStage(stageInfo.StageNumber) {
+				return nil
+			}
+		}
+		return fmt.Errorf("this run covers stages up to %d, nothing to run for %s", cascadedConfig.TargetStageNumber, sel.describe())
+	}
 	return nil
 }
 
-func runSingleTest(test client.Test, testConfig *client.TestConfig, runCommand string) (*client.TestResult, error) {
+// describeSandboxes lists the kept sandboxes of a stage, one line per
+// attempt of a test
+func describeSandboxes(stageNumber int, tests []client.Test, sandboxDirs [][]string) []string {
+	var lines []string
+	for testIdx, dirs := range sandboxDirs {
+		for attempt, dir := range dirs {
+			name := tests[testIdx].TestName
+			if len(dirs) > 1 {
+				name = fmt.Sprintf("%s (attempt %d)", name, attempt+1)
+			}
+			lines = append(lines, fmt.Sprintf("Stage %02d / %s: %s", stageNumber, name, dir))
+		}
+	}
+	return lines
+}
+
+// newTestWorkspace returns the directory a single test runs in
+func newTestWorkspace(projectRoot string, opts runOptions) (*runner.Workspace, error) {
+	if opts.sandbox == "" {
+		workspace := runner.ProjectWorkspace(projectRoot)
+		workspace.AllowTrackedDeletes = opts.allowTrackedDeletes
+		return workspace, nil
+	}
+	return runner.NewSandbox(projectRoot, opts.sandbox)
+}
+
+// getNoNetwork reads the no-network flag. Where programs can't be isolated,
+// tests run with network access after a warning rather than not at all.
+func getNoNetwork(cmd *cobra.Command) (bool, error) {
+	noNetwork, err := cmd.Flags().GetBool("no-network")
+	if err != nil {
+		return false, fmt.Errorf("failed to get no-network flag: %w", err)
+	}
+	if !noNetwork {
+		return false, nil
+	}
+	if err := runner.CheckNetworkIsolation(); err != nil {
+		fmt.Printf("Warning: --no-network is not available here (%v), tests run with network access\n", err)
+		return false, nil
+	}
+	return true, nil
+}
+
+// testOptions returns what the program of test runs with, apart from the
+// directory
+func testOptions(test client.Test, testConfig *client.TestConfig, runOpts runOptions) runner.TestOptions {
+	return runner.TestOptions{
+		Interactive: getInteractiveConfig(test, testConfig),
+		Env:         test.Env,
+		Limits:      getLimits(test, testConfig),
+		Hermetic:    runOpts.hermetic,
+		NoNetwork:   runOpts.noNetwork,
+	}
+}
+
+// runSingleTest runs one test in workspace. HTTP tests run against server
+// when set, otherwise they start a server of their own.
+func runSingleTest(ctx context.Context, test client.Test, testConfig *client.TestConfig, runCommand *runner.Command,
+	workspace *runner.Workspace, runOpts runOptions, server *runner.StageServer) (*client.TestResult, error) {
 	// Execute setup operations
-	if err := runner.ExecuteSetup(test.Setup); err != nil {
+	if err := runner.ExecuteSetup(test.Setup, workspace); err != nil {
 		return nil, fmt.Errorf("setup failed: %w", err)
 	}
 
-	// Ensure cleanup runs even if test fails
+	// Ensure cleanup runs even if test fails, a sandbox is discarded
+	// (or kept for inspection) as a whole instead, unless it is shared with
+	// the next tests through a stage server
 	defer func() {
-		if test.Cleanup != nil {
-			if err := runner.ExecuteCleanup(test.Cleanup); err != nil {
+		if test.Cleanup != nil && (!workspace.Sandbox || server != nil) {
+			if err := runner.ExecuteCleanup(test.Cleanup, workspace); err != nil {
 				fmt.Printf("Warning: cleanup failed: %v\n", err)
 			}
 		}
@@ -224,6 +589,9 @@ func runSingleTest(test client.Test, testConfig *client.TestConfig, runCommand s
 	var result *client.TestResult
 	var err error
 
+	opts := testOptions(test, testConfig, runOpts)
+	opts.Dir = workspace.Dir
+
 	// Run test based on type
 	if testConfig.TestType == "http_server" {
 		// Run HTTP test
@@ -231,20 +599,34 @@ func runSingleTest(test client.Test, testConfig *client.TestConfig, runCommand s
 			return nil, fmt.Errorf("HTTP test configuration missing programConfig or serverConfig")
 		}
 
-		result, err = runner.RunHTTPTest(
-			testConfig.ProgramConfig,
-			testConfig.ServerConfig,
-			runCommand,
-			test,
-		)
+		if server != nil {
+			result, err = server.RunTest(ctx, test, opts)
+		} else {
+			result, err = runner.RunHTTPTest(
+				ctx,
+				testConfig.ProgramConfig,
+				testConfig.ServerConfig,
+				runCommand,
+				test,
+				opts,
+			)
+		}
+	} else if opts.Interactive.Mode == client.InputModePTY {
+		// Run CLI test attached to a terminal
+		result, err = runner.RunPTYTest(ctx, runCommand, test, opts)
 	} else {
 		// Run CLI test
-		result, err = runner.RunCLITest(
-			runCommand,
-			test.Stdin,
-			test.TimeoutSeconds,
-		)
+		result, err = runner.RunCLITest(ctx, runCommand, test, opts)
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	// Collect files before the deferred cleanup deletes them, paths that
+	// can't be collected are recorded with their error
+	if len(test.Collect) > 0 {
+		result.Files = runner.CollectFiles(test.Collect, workspace)
 	}
 
-	return result, err
+	return result, nil
 }
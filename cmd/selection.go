@@ -0,0 +1,146 @@
+package cmd
+
+import (
+	"fmt"
+	"path"
+	"regexp"
+	"strings"
+
+	"github.com/chibuka/95/client"
+	"github.com/spf13/cobra"
+)
+
+// selection narrows a run down to some stages of the cascade, or some tests
+type selection struct {
+	// stage number range, 0 means unbounded
+	from int
+	to   int
+	// raw --test value and its compiled form
+	pattern string
+	match   func(testName string) bool
+}
+
+// addSelectionFlags registers the stage and test selection flags
+func addSelectionFlags(cmd *cobra.Command) {
+	cmd.Flags().Int("only-stage", 0, "Run only this stage number")
+	cmd.Flags().Int("from", 0, "Run stages starting at this stage number")
+	cmd.Flags().Int("to", 0, "Run stages up to this stage number")
+	cmd.Flags().String("test", "", "Run only tests whose name matches a glob (e.g. 'empty*'), or a regex written as /regex/")
+}
+
+// getSelection reads the flags registered by addSelectionFlags
+func getSelection(cmd *cobra.Command) (selection, error) {
+	var sel selection
+
+	only, err := cmd.Flags().GetInt("only-stage")
+	if err != nil {
+		return sel, fmt.Errorf("failed to get only-stage flag: %w", err)
+	}
+	if sel.from, err = cmd.Flags().GetInt("from"); err != nil {
+		return sel, fmt.Errorf("failed to get from flag: %w", err)
+	}
+	if sel.to, err = cmd.Flags().GetInt("to"); err != nil {
+		return sel, fmt.Errorf("failed to get to flag: %w", err)
+	}
+
+	if only != 0 {
+		if sel.from != 0 || sel.to != 0 {
+			return sel, fmt.Errorf("--only-stage can't be combined with --from or --to")
+		}
+		sel.from, sel.to = only, only
+	}
+	if sel.from < 0 || sel.to < 0 {
+		return sel, fmt.Errorf("stage numbers can't be negative")
+	}
+	if sel.to != 0 && sel.from > sel.to {
+		return sel, fmt.Errorf("--from %d is after --to %d", sel.from, sel.to)
+	}
+
+	if sel.pattern, err = cmd.Flags().GetString("test"); err != nil {
+		return sel, fmt.Errorf("failed to get test flag: %w", err)
+	}
+	if sel.match, err = compileTestPattern(sel.pattern); err != nil {
+		return sel, err
+	}
+
+	return sel, nil
+}
+
+// compileTestPattern turns --test into a name matcher: /.../ is a regular
+// expression, anything else a glob matched against the whole name
+func compileTestPattern(pattern string) (func(string) bool, error) {
+	if pattern == "" {
+		return nil, nil
+	}
+
+	if len(pattern) >= 2 && strings.HasPrefix(pattern, "/") && strings.HasSuffix(pattern, "/") {
+		re, err := regexp.Compile(pattern[1 : len(pattern)-1])
+		if err != nil {
+			return nil, fmt.Errorf("invalid --test regex: %w", err)
+		}
+		return re.MatchString, nil
+	}
+
+	if _, err := path.Match(pattern, ""); err != nil {
+		return nil, fmt.Errorf("invalid --test glob %q: %w", pattern, err)
+	}
+	return func(name string) bool {
+		matched, _ := path.Match(pattern, name)
+		return matched
+	}, nil
+}
+
+// isSet reports whether anything was selected, as opposed to a full run
+func (s selection) isSet() bool {
+	return s.from != 0 || s.to != 0 || s.match != nil
+}
+
+// hasStages reports whether the selection is a stage range
+func (s selection) hasStages() bool {
+	return s.from != 0 || s.to != 0
+}
+
+// includesStage reports whether a stage number is in the selected range
+func (s selection) includesStage(stageNumber int) bool {
+	if s.from != 0 && stageNumber < s.from {
+		return false
+	}
+	if s.to != 0 && stageNumber > s.to {
+		return false
+	}
+	return true
+}
+
+// filterTests returns the selected tests of a stage
+func (s selection) filterTests(tests []client.Test) []client.Test {
+	if s.match == nil {
+		return tests
+	}
+
+	var selected []client.Test
+	for _, test := range tests {
+		if s.match(test.TestName) {
+			selected = append(selected, test)
+		}
+	}
+	return selected
+}
+
+// describe renders the selection for messages
+func (s selection) describe() string {
+	var parts []string
+	switch {
+	case s.from != 0 && s.from == s.to:
+		parts = append(parts, fmt.Sprintf("stage %d", s.from))
+	case s.from != 0 && s.to != 0:
+		parts = append(parts, fmt.Sprintf("stages %d to %d", s.from, s.to))
+	case s.from != 0:
+		parts = append(parts, fmt.Sprintf("stages from %d", s.from))
+	case s.to != 0:
+		parts = append(parts, fmt.Sprintf("stages up to %d", s.to))
+	}
+	if s.pattern != "" {
+		parts = append(parts, fmt.Sprintf("tests matching %s", s.pattern))
+	}
+	return strings.Join(parts, ", ")
+}
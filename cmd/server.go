@@ -0,0 +1,71 @@
+package cmd
+
+import (
+	"fmt"
+
+	"github.com/chibuka/95/client"
+	"github.com/chibuka/95/internal/runner"
+)
+
+// stageServer is the server of an HTTP stage whose server lifetime is
+// "stage", along with the workspace it runs in: the tests it serves share the
+// same directory, even in a sandbox. Its tests run one at a time, see
+// runStageTests, so it needs no locking.
+type stageServer struct {
+	server      *runner.StageServer
+	projectRoot string
+	opts        runOptions
+	workspace   *runner.Workspace
+}
+
+// newStageServer returns the server of the stage, nil when every test starts
+// its own
+func newStageServer(testConfig *client.TestConfig, runCommand *runner.Command, projectRoot string, opts runOptions) *stageServer {
+	if testConfig.TestType != "http_server" || testConfig.ServerConfig == nil ||
+		testConfig.ServerConfig.Lifetime != client.ServerLifetimeStage {
+		return nil
+	}
+	return &stageServer{
+		server:      runner.NewStageServer(testConfig.ProgramConfig, testConfig.ServerConfig, runCommand),
+		projectRoot: projectRoot,
+		opts:        opts,
+	}
+}
+
+// workspaceFor returns the workspace test runs in with opts: the one of the
+// running server, or a new one when the test starts a new server
+func (s *stageServer) workspaceFor(test client.Test, opts runner.TestOptions) (*runner.Workspace, error) {
+	if s.workspace != nil && !s.server.NeedsStart(test, opts) {
+		return s.workspace, nil
+	}
+	s.stop()
+
+	workspace, err := newTestWorkspace(s.projectRoot, s.opts)
+	if err != nil {
+		return nil, err
+	}
+	s.workspace = workspace
+	return workspace, nil
+}
+
+// target returns the server tests run against, nil without a stage server
+func (s *stageServer) target() *runner.StageServer {
+	if s == nil {
+		return nil
+	}
+	return s.server
+}
+
+// stop stops the server and removes its workspace, unless sandboxes are kept
+func (s *stageServer) stop() {
+	if s == nil {
+		return
+	}
+	s.server.Stop()
+	if s.workspace != nil && !s.opts.keep {
+		if err := s.workspace.Remove(); err != nil {
+			fmt.Printf("Warning: failed to remove sandbox: %v\n", err)
+		}
+	}
+	s.workspace = nil
+}
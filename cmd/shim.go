@@ -0,0 +1,26 @@
+package cmd
+
+import (
+	"github.com/chibuka/95/internal/runner"
+	"github.com/spf13/cobra"
+)
+
+// shimCmd is what test programs are started through when their process
+// needs preparing first, it isn't meant to be run by hand
+var shimCmd = &cobra.Command{
+	Use:                runner.ShimCommand + " <spec> <program> [args...]",
+	Short:              "Prepare the process of a test program and start it",
+	Hidden:             true,
+	DisableFlagParsing: true,
+	SilenceUsage:       true,
+	// the shim runs as the test program, possibly with a hermetic home, it
+	// must not touch the 95 config
+	PersistentPreRun: func(cmd *cobra.Command, args []string) {},
+	RunE: func(cmd *cobra.Command, args []string) error {
+		return runner.RunShim(args)
+	},
+}
+
+func init() {
+	rootCmd.AddCommand(shimCmd)
+}
@@ -1,6 +1,11 @@
 package cmd
 
 import (
+	"context"
+	"os"
+	"os/signal"
+	"syscall"
+
 	"github.com/spf13/cobra"
 )
 
@@ -15,14 +20,33 @@ against the tests, and shows you the results. No submission is made to the serve
 Example:
   95 test d533f704-66aa-4dd7-ae7d-f59f505e9839
 
+  # Run each test in a throwaway copy of the project, keep them to inspect:
+  95 test d533f704-66aa-4dd7-ae7d-f59f505e9839 --sandbox --keep
+
 After tests pass, use '95 run' to submit your solution and track progress.`,
 	Args: cobra.ExactArgs(1),
 	RunE: func(cmd *cobra.Command, args []string) error {
 		stageUuid := args[0]
-		return runOrTest(stageUuid, false)
+		opts, err := getRunOptions(cmd)
+		if err != nil {
+			return err
+		}
+		if opts.watch {
+			return watchAndRun(stageUuid, false, opts)
+		}
+		// an interrupted run is not a usage error
+		cmd.SilenceUsage = true
+
+		// Ctrl-C cancels the run, which stops the program under test and
+		// its children instead of leaving them running
+		ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+		defer stop()
+		_, err = runOrTest(ctx, stageUuid, false, opts)
+		return err
 	},
 }
 
 func init() {
 	rootCmd.AddCommand(testCmd)
+	addRunFlags(testCmd)
 }
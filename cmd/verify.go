@@ -0,0 +1,83 @@
+package cmd
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/chibuka/95/client"
+	"github.com/chibuka/95/internal/config"
+	"github.com/chibuka/95/internal/project"
+)
+
+// verification tracks which stages the server already accepted for the
+// current source tree, so a cascade doesn't run them again
+type verification struct {
+	root     string
+	verified *config.VerifiedStages
+	changed  bool
+}
+
+// loadVerification hashes the project and loads the stages verified for it.
+// Anything verified for other sources or commands is forgotten.
+func loadVerification(root string, projectCfg *config.ProjectConfig) (*verification, error) {
+	sourceHash, err := project.HashTree(root)
+	if err != nil {
+		return nil, err
+	}
+
+	verified, err := config.LoadVerifiedStages(root)
+	if err != nil {
+		return nil, err
+	}
+
+	// everything that decides what program the tests run against
+	commands := strings.Join([]string{
+		projectCfg.RunCommand,
+		projectCfg.BuildCommand,
+		projectCfg.ArtifactCommand,
+		strconv.FormatBool(projectCfg.Shell),
+	}, "\x00")
+
+	v := &verification{root: root, verified: verified}
+	if verified.SourceHash != sourceHash || verified.Commands != commands || verified.Stages == nil {
+		v.verified = &config.VerifiedStages{
+			SourceHash: sourceHash,
+			Commands:   commands,
+			Stages:     make(map[string]config.VerifiedStage),
+		}
+		v.changed = true
+	}
+	return v, nil
+}
+
+// isVerified reports whether the stage passed before with the same tests
+func (v *verification) isVerified(stageInfo client.StageTestInfo) bool {
+	stage, ok := v.verified.Stages[stageInfo.StageUuid]
+	return ok && stage.ConfigHash == stageConfigHash(stageInfo)
+}
+
+// markVerified records a stage the server accepted
+func (v *verification) markVerified(stageInfo client.StageTestInfo) {
+	v.verified.Stages[stageInfo.StageUuid] = config.VerifiedStage{
+		StageNumber: stageInfo.StageNumber,
+		ConfigHash:  stageConfigHash(stageInfo),
+		VerifiedAt:  time.Now(),
+	}
+	v.changed = true
+}
+
+// save writes the verified stages back to the cache, if anything changed
+func (v *verification) save() error {
+	if !v.changed {
+		return nil
+	}
+	return config.SaveVerifiedStages(v.root, v.verified)
+}
+
+func stageConfigHash(stageInfo client.StageTestInfo) string {
+	sum := sha256.Sum256([]byte(stageInfo.TestConfig))
+	return hex.EncodeToString(sum[:])
+}
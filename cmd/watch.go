@@ -0,0 +1,215 @@
+package cmd
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io/fs"
+	"os"
+	"os/signal"
+	"path/filepath"
+	"syscall"
+	"time"
+
+	"github.com/chibuka/95/internal/project"
+	"github.com/chibuka/95/internal/runner"
+	"github.com/chibuka/95/ui"
+	"github.com/fsnotify/fsnotify"
+)
+
+// watchDebounce is how long the project has to be quiet after a change
+// before the tests run again, editors often write a file in several steps
+const watchDebounce = 300 * time.Millisecond
+
+// watchAndRun runs the cascade, then again every time a project file changes,
+// until interrupted. A change during a run cancels it.
+func watchAndRun(stageUuid string, isSubmit bool, opts runOptions) error {
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
+
+	root, err := os.Getwd()
+	if err != nil {
+		return fmt.Errorf("failed to get current directory: %w", err)
+	}
+
+	watcher, err := fsnotify.NewWatcher()
+	if err != nil {
+		return fmt.Errorf("failed to start file watcher: %w", err)
+	}
+	defer watcher.Close()
+
+	if err := watchTree(watcher, root); err != nil {
+		return fmt.Errorf("failed to watch project: %w", err)
+	}
+
+	// Tests write into a sandbox, otherwise their own files would trigger
+	// the next run. Linking is enough for that and doesn't copy the
+	// dependencies on every change, --sandbox=copy still applies.
+	if opts.sandbox == "" {
+		opts.sandbox = runner.SandboxLink
+	}
+
+	debounce := time.NewTimer(watchDebounce)
+	debounce.Stop()
+
+	for {
+		runCtx, cancel := context.WithCancel(ctx)
+		finished := make(chan struct{})
+		ready := make(chan string, 1)
+
+		clearScreen()
+		runOpts := opts
+		runOpts.sourceReady = func(sourceHash string) { ready <- sourceHash }
+		start := time.Now()
+		go func() {
+			defer close(finished)
+			summary, err := runOrTest(runCtx, stageUuid, isSubmit, runOpts)
+			if runCtx.Err() != nil {
+				return
+			}
+			if err != nil {
+				fmt.Printf("Error: %v\n\n", err)
+			}
+			printWatchSummary(summary, time.Since(start))
+		}()
+
+		// the sources the run is testing, unknown until the build is done
+		sourceHash := ""
+		// a change came in before the hash was known
+		pendingChange := false
+		running := true
+		stopRun := func() {
+			cancel()
+			if running {
+				<-finished
+			}
+		}
+
+	wait:
+		for {
+			select {
+			case <-ctx.Done():
+				stopRun()
+				fmt.Println("Stopped watching.")
+				return nil
+
+			case <-finished:
+				running = false
+				finished = nil
+				// the run stopped before it got to hash the sources, e.g.
+				// the build failed, changes are compared against them as is
+				if sourceHash == "" {
+					sourceHash, _ = project.HashTree(root)
+				}
+
+			case hash := <-ready:
+				sourceHash = hash
+				if pendingChange && sourcesChanged(root, sourceHash) {
+					break wait
+				}
+				pendingChange = false
+
+			case event, ok := <-watcher.Events:
+				if !ok {
+					stopRun()
+					return nil
+				}
+				if isIgnoredPath(root, event.Name) {
+					continue
+				}
+				// new directories need watches of their own
+				if event.Has(fsnotify.Create) {
+					if info, err := os.Lstat(event.Name); err == nil && info.IsDir() {
+						_ = watchTree(watcher, event.Name)
+					}
+				}
+				debounce.Reset(watchDebounce)
+
+			case err, ok := <-watcher.Errors:
+				if !ok {
+					stopRun()
+					return nil
+				}
+				fmt.Printf("Warning: file watcher: %v\n", err)
+
+			case <-debounce.C:
+				if running && sourceHash == "" {
+					// still building, decide once the run knows its sources
+					pendingChange = true
+					continue
+				}
+				// build outputs and editor swap files come and go without
+				// changing the sources
+				if sourceHash == "" || sourcesChanged(root, sourceHash) {
+					break wait
+				}
+			}
+		}
+
+		stopRun()
+	}
+}
+
+// watchTree adds a watch on dir and every directory below it, skipping
+// dependency and build output directories
+func watchTree(watcher *fsnotify.Watcher, dir string) error {
+	return filepath.WalkDir(dir, func(path string, d fs.DirEntry, err error) error {
+		if err != nil {
+			// the directory may be gone already
+			if errors.Is(err, fs.ErrNotExist) {
+				return nil
+			}
+			return err
+		}
+		if !d.IsDir() {
+			return nil
+		}
+		if path != dir && project.IsIgnoredDir(d.Name()) {
+			return filepath.SkipDir
+		}
+		return watcher.Add(path)
+	})
+}
+
+// isIgnoredPath reports whether a changed path is inside an ignored directory
+func isIgnoredPath(root string, path string) bool {
+	rel, err := filepath.Rel(root, path)
+	if err != nil {
+		return false
+	}
+	for dir := filepath.Dir(rel); dir != "." && dir != string(filepath.Separator); dir = filepath.Dir(dir) {
+		if project.IsIgnoredDir(filepath.Base(dir)) {
+			return true
+		}
+	}
+	// a change to an ignored directory itself, e.g. creating target/
+	return project.IsIgnoredDir(filepath.Base(rel))
+}
+
+// sourcesChanged reports whether the project no longer matches sourceHash
+func sourcesChanged(root string, sourceHash string) bool {
+	hash, err := project.HashTree(root)
+	return err != nil || hash != sourceHash
+}
+
+// clearScreen clears the terminal and moves the cursor to the top
+func clearScreen() {
+	fmt.Print("\033[H\033[2J")
+}
+
+// printWatchSummary prints a one line result after each run in watch mode
+func printWatchSummary(summary *runSummary, elapsed time.Duration) {
+	status := ui.MutedStyle.Render(fmt.Sprintf("%s · %.1fs · watching for changes, Ctrl-C to stop",
+		time.Now().Format("15:04:05"), elapsed.Seconds()))
+
+	switch {
+	case summary == nil:
+		fmt.Println(ui.FailureStyle.Render("✗ Run failed") + "  " + status)
+	case !summary.validated:
+		fmt.Println(fmt.Sprintf("● %d tests ran", summary.totalTests) + "  " + status)
+	case summary.passed:
+		fmt.Println(ui.SuccessStyle.Render(fmt.Sprintf("✓ %d/%d tests passed", summary.totalPassed, summary.totalTests)) + "  " + status)
+	default:
+		fmt.Println(ui.FailureStyle.Render(fmt.Sprintf("✗ %d/%d tests passed", summary.totalPassed, summary.totalTests)) + "  " + status)
+	}
+}
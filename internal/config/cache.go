@@ -0,0 +1,167 @@
+package config
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"time"
+)
+
+// BuildState records the last successful build of a project
+type BuildState struct {
+	BuildCommand string `json:"buildCommand"`
+	SourceHash   string `json:"sourceHash"`
+}
+
+// VerifiedStages records the stages the server accepted for one version of
+// the project: its source tree and the commands used to build and run it
+type VerifiedStages struct {
+	SourceHash string `json:"sourceHash"`
+	Commands   string `json:"commands"`
+	// by stage uuid
+	Stages map[string]VerifiedStage `json:"stages"`
+}
+
+// VerifiedStage is a stage that passed, with a hash of the test config it
+// passed against so a changed stage is run again
+type VerifiedStage struct {
+	StageNumber int       `json:"stageNumber"`
+	ConfigHash  string    `json:"configHash"`
+	VerifiedAt  time.Time `json:"verifiedAt"`
+}
+
+// BenchBaselines are the saved benchmark results of a project, by stage uuid
+type BenchBaselines struct {
+	Stages map[string]BenchBaseline `json:"stages"`
+}
+
+// BenchBaseline is one saved benchmark of a stage, by test name, and by test
+// name and request for the latency of HTTP requests
+type BenchBaseline struct {
+	SavedAt time.Time             `json:"savedAt"`
+	Runs    int                   `json:"runs"`
+	Entries map[string]BenchStats `json:"entries"`
+}
+
+// BenchStats is how long something took over the runs of a benchmark, and
+// how much memory it used when that was measured
+type BenchStats struct {
+	TimeUs    Distribution `json:"timeUs"`
+	PeakRSSKB Distribution `json:"peakRssKb,omitzero"`
+}
+
+// Distribution summarizes the samples of a benchmark
+type Distribution struct {
+	Min    int64 `json:"min"`
+	Median int64 `json:"median"`
+	P95    int64 `json:"p95"`
+	Max    int64 `json:"max"`
+}
+
+// ProjectCacheDir returns the directory holding cached state for the project
+// at root, under ~/.95cli/cache so nothing is written into the project itself
+func ProjectCacheDir(root string) (string, error) {
+	home, err := os.UserHomeDir()
+	if err != nil {
+		return "", err
+	}
+
+	absRoot, err := filepath.Abs(root)
+	if err != nil {
+		return "", err
+	}
+	sum := sha256.Sum256([]byte(absRoot))
+
+	dir := filepath.Join(home, ".95cli", "cache", hex.EncodeToString(sum[:8]))
+	if err := os.MkdirAll(dir, 0700); err != nil {
+		return "", fmt.Errorf("failed to create cache directory: %w", err)
+	}
+	return dir, nil
+}
+
+// LoadBuildState reads the last successful build of the project at root.
+// A project that was never built returns an empty state.
+func LoadBuildState(root string) (*BuildState, error) {
+	var state BuildState
+	if err := loadCacheFile(root, "build.json", &state); err != nil {
+		return nil, err
+	}
+	return &state, nil
+}
+
+// SaveBuildState records a successful build of the project at root
+func SaveBuildState(root string, state *BuildState) error {
+	return saveCacheFile(root, "build.json", state)
+}
+
+// LoadVerifiedStages reads the stages verified for the project at root
+func LoadVerifiedStages(root string) (*VerifiedStages, error) {
+	var verified VerifiedStages
+	if err := loadCacheFile(root, "verified.json", &verified); err != nil {
+		return nil, err
+	}
+	return &verified, nil
+}
+
+// SaveVerifiedStages records the stages verified for the project at root
+func SaveVerifiedStages(root string, verified *VerifiedStages) error {
+	return saveCacheFile(root, "verified.json", verified)
+}
+
+// LoadBenchBaselines reads the saved benchmarks of the project at root
+func LoadBenchBaselines(root string) (*BenchBaselines, error) {
+	var baselines BenchBaselines
+	if err := loadCacheFile(root, "bench.json", &baselines); err != nil {
+		return nil, err
+	}
+	if baselines.Stages == nil {
+		baselines.Stages = make(map[string]BenchBaseline)
+	}
+	return &baselines, nil
+}
+
+// SaveBenchBaselines records the saved benchmarks of the project at root
+func SaveBenchBaselines(root string, baselines *BenchBaselines) error {
+	return saveCacheFile(root, "bench.json", baselines)
+}
+
+func loadCacheFile(root string, name string, v any) error {
+	dir, err := ProjectCacheDir(root)
+	if err != nil {
+		return err
+	}
+
+	data, err := os.ReadFile(filepath.Join(dir, name))
+	if err != nil {
+		if os.IsNotExist(err) {
+			return nil
+		}
+		return fmt.Errorf("failed to read %s: %w", name, err)
+	}
+
+	if err := json.Unmarshal(data, v); err != nil {
+		// a corrupt cache is the same as no cache
+		return nil
+	}
+	return nil
+}
+
+func saveCacheFile(root string, name string, v any) error {
+	dir, err := ProjectCacheDir(root)
+	if err != nil {
+		return err
+	}
+
+	data, err := json.MarshalIndent(v, "", "  ")
+	if err != nil {
+		return fmt.Errorf("failed to marshal %s: %w", name, err)
+	}
+
+	if err := os.WriteFile(filepath.Join(dir, name), data, 0600); err != nil {
+		return fmt.Errorf("failed to write %s: %w", name, err)
+	}
+	return nil
+}
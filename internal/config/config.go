@@ -35,6 +35,20 @@ func (cfg *Config) GetAPIURL() string {
 type ProjectConfig struct {
 	RunCommand string `json:"runCommand"`
 	Language   string `json:"language"`
+	// Run the command through sh instead of splitting it into arguments
+	Shell bool `json:"shell"`
+	// Optional: compiles the project once before the tests run
+	BuildCommand string `json:"buildCommand"`
+	// Optional: runs the built program, used by tests instead of RunCommand
+	ArtifactCommand string `json:"artifactCommand"`
+}
+
+// TestCommand returns the command tests run the program with
+func (cfg *ProjectConfig) TestCommand() string {
+	if cfg.ArtifactCommand != "" {
+		return cfg.ArtifactCommand
+	}
+	return cfg.RunCommand
 }
 
 func Init() {
@@ -128,8 +142,8 @@ func LoadProjectConfig() (*ProjectConfig, error) {
 	return &cfg, nil
 }
 
-// SaveProjectConfig writes runCommand and language to config.json in current directory
-func SaveProjectConfig(runCommand string, language string) error {
+// SaveProjectConfig writes the project config to config.json in current directory
+func SaveProjectConfig(cfg *ProjectConfig) error {
 	currDir, err := os.Getwd()
 	if err != nil {
 		return fmt.Errorf("failed to get current directory: %w", err)
@@ -139,8 +153,11 @@ func SaveProjectConfig(runCommand string, language string) error {
 	v.AddConfigPath(currDir)
 	v.SetConfigFile("config")
 	v.SetConfigType("json")
-	v.Set("runCommand", runCommand)
-	v.Set("language", language)
+	v.Set("runCommand", cfg.RunCommand)
+	v.Set("language", cfg.Language)
+	v.Set("shell", cfg.Shell)
+	v.Set("buildCommand", cfg.BuildCommand)
+	v.Set("artifactCommand", cfg.ArtifactCommand)
 
 	// safeWriteConfig does not seem to be safe!
 	err = v.SafeWriteConfig()
@@ -0,0 +1,110 @@
+package project
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"io/fs"
+	"os"
+	"path/filepath"
+)
+
+// vcsDirs hold version control metadata, never needed to run a program
+var vcsDirs = map[string]bool{
+	".git": true,
+	".hg":  true,
+	".svn": true,
+}
+
+// ignoredDirs are VCS metadata, dependency and build output directories.
+// They are not part of the source tree a solution is judged on.
+var ignoredDirs = map[string]bool{
+	".git":         true,
+	".hg":          true,
+	".svn":         true,
+	".idea":        true,
+	".vscode":      true,
+	".gradle":      true,
+	".venv":        true,
+	"venv":         true,
+	"__pycache__":  true,
+	"node_modules": true,
+	"target":       true,
+	"build":        true,
+	"dist":         true,
+	"out":          true,
+	"bin":          true,
+	"obj":          true,
+	"zig-out":      true,
+	".zig-cache":   true,
+}
+
+// IsIgnoredDir reports whether a directory with this name is skipped when
+// looking at the project source tree
+func IsIgnoredDir(name string) bool {
+	return ignoredDirs[name]
+}
+
+// IsVCSDir reports whether a directory with this name is version control metadata
+func IsVCSDir(name string) bool {
+	return vcsDirs[name]
+}
+
+// HashTree returns a content hash of every source file under root. Files in
+// ignored directories don't count, so build outputs don't change the hash.
+func HashTree(root string) (string, error) {
+	h := sha256.New()
+
+	err := filepath.WalkDir(root, func(path string, d fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		if d.IsDir() {
+			if path != root && IsIgnoredDir(d.Name()) {
+				return filepath.SkipDir
+			}
+			return nil
+		}
+
+		rel, err := filepath.Rel(root, path)
+		if err != nil {
+			return err
+		}
+		info, err := d.Info()
+		if err != nil {
+			return err
+		}
+
+		// the path and mode are part of the hash, so renames and chmod +x count
+		fmt.Fprintf(h, "%s\x00%o\x00", filepath.ToSlash(rel), info.Mode())
+
+		if d.Type()&fs.ModeSymlink != 0 {
+			target, err := os.Readlink(path)
+			if err != nil {
+				return err
+			}
+			fmt.Fprintf(h, "%s\x00", target)
+			return nil
+		}
+		if !info.Mode().IsRegular() {
+			return nil
+		}
+
+		f, err := os.Open(path)
+		if err != nil {
+			return err
+		}
+		defer f.Close()
+		if _, err := io.Copy(h, f); err != nil {
+			return err
+		}
+		h.Write([]byte{0})
+		return nil
+	})
+	if err != nil {
+		return "", fmt.Errorf("failed to hash project files: %w", err)
+	}
+
+	return hex.EncodeToString(h.Sum(nil)), nil
+}
@@ -0,0 +1,38 @@
+package runner
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"time"
+)
+
+// buildTimeout bounds a project build, compiling can be slow but should never hang
+const buildTimeout = 10 * time.Minute
+
+// RunBuild runs the project build command and returns its combined output,
+// cancelling ctx stops the build
+func RunBuild(ctx context.Context, command *Command) (string, error) {
+	ctx, cancel := context.WithTimeout(ctx, buildTimeout)
+	defer cancel()
+
+	execCmd := command.command(ctx)
+	execCmd.SysProcAttr = sysProcAttr()
+	group := newProcessGroup(execCmd)
+
+	// same writer for both, so the output keeps its original order
+	var output bytes.Buffer
+	execCmd.Stdout = &output
+	execCmd.Stderr = &output
+
+	if err := execCmd.Start(); err != nil {
+		return "", fmt.Errorf("failed to start build: %w", err)
+	}
+
+	err := group.wait()
+	if errors.Is(ctx.Err(), context.DeadlineExceeded) {
+		return output.String(), fmt.Errorf("build did not finish within %s", buildTimeout)
+	}
+	return output.String(), err
+}
@@ -1,71 +1,96 @@
 package runner
 
 import (
-	"bytes"
 	"context"
 	"fmt"
-	"os/exec"
-	"strings"
+	"sync/atomic"
 	"time"
 
 	"github.com/chibuka/95/client"
 )
 
-func RunCLITest(runCommand string, stdin string, timeoutSeconds int) (*client.TestResult, error) {
-	splitRunCmd := strings.Fields(runCommand)
-	if len(splitRunCmd) == 0 {
-		return nil, fmt.Errorf("run command is empty")
-	}
-	cmd, args := splitRunCmd[0], splitRunCmd[1:]
-
-	ctx, cancel := context.WithTimeout(context.Background(), time.Duration(timeoutSeconds)*time.Second)
+// RunCLITest runs the program with stdin connected to a pipe. Input is written
+// one command at a time and the output is split into a per-command transcript.
+// Cancelling ctx stops the program like a timeout does.
+func RunCLITest(ctx context.Context, command *Command, test client.Test, opts TestOptions) (*client.TestResult, error) {
+	ctx, cancel := context.WithTimeout(ctx, time.Duration(test.TimeoutSeconds)*time.Second)
 	defer cancel()
 
-	execCmd := exec.CommandContext(ctx, cmd, args...)
+	execCmd := command.command(ctx)
+	execCmd.Dir = opts.Dir
+	cleanupEnv, err := setupEnv(execCmd, command, opts, opts.Env)
+	if err != nil {
+		return nil, err
+	}
+	defer cleanupEnv()
+	// own process group, so a timeout also kills the children of 'go run' and friends
+	execCmd.SysProcAttr = sysProcAttr()
+	group := newProcessGroup(execCmd)
+
+	// too much output stops the program, like a timeout
+	var outputExceeded atomic.Bool
+	stopOnOverflow := func() {
+		outputExceeded.Store(true)
+		cancel()
+	}
 
-	var stdoutBuffer bytes.Buffer
-	var stderrBuffer bytes.Buffer
+	var stdoutBuffer, stderrBuffer outputRecorder
+	stdoutBuffer.setLimit(outputLimit(opts.Limits), stopOnOverflow)
+	stderrBuffer.setLimit(outputLimit(opts.Limits), stopOnOverflow)
 	execCmd.Stdout = &stdoutBuffer
 	execCmd.Stderr = &stderrBuffer
 
+	if err := prepareProcess(execCmd, opts.Limits, opts.NoNetwork); err != nil {
+		return nil, fmt.Errorf("failed to prepare process: %w", err)
+	}
+
 	stdinPipe, err := execCmd.StdinPipe()
 	if err != nil {
 		return nil, fmt.Errorf("failed to create stdin pipe: %w", err)
 	}
 
 	// this is non-blocking
+	start := time.Now()
 	err = execCmd.Start()
 	if err != nil {
 		return nil, fmt.Errorf("failed to start command: %w", err)
 	}
 
-	// sending test input
-	_, err = stdinPipe.Write([]byte(stdin))
-	if err != nil {
-		return nil, fmt.Errorf("failed to write stdin: %w", err)
-	}
+	exited := make(chan struct{})
+	var waitErr error
+	go func() {
+		waitErr = group.wait()
+		close(exited)
+	}()
 
-	err = stdinPipe.Close()
-	if err != nil {
-		return nil, fmt.Errorf("failed to close stdin pipe: %w", err)
-	}
+	// sending test input one command at a time, waiting for the prompt or,
+	// by default, for the program to fall quiet
+	session := newInteractiveSession(opts.Interactive, stdinPipe, &stdoutBuffer, exited)
+	transcript := session.run(ctx, test.Stdin)
 
-	err = execCmd.Wait()
+	// closing stdin tells the program there is no more input,
+	// the pipe is already closed if the program exited on its own
+	_ = stdinPipe.Close()
 
-	exitCode := 0
-	if err != nil {
-		// check if it's a non-zero exit code (expected)
-		if exitErr, ok := err.(*exec.ExitError); ok {
-			exitCode = exitErr.ExitCode()
-		} else {
-			// Some other error (timeout, command not found, etc.)
-			return nil, fmt.Errorf("command execution failed: %w", err)
-		}
+	<-exited
+	duration := time.Since(start)
+
+	result := &client.TestResult{
+		Stdout:          stdoutBuffer.String(),
+		Stderr:          stderrBuffer.String(),
+		Transcript:      transcript,
+		ReapedProcesses: group.reaped,
+		DurationMs:      duration.Milliseconds(),
+		DurationUs:      duration.Microseconds(),
+		Usage:           measureUsage(execCmd.ProcessState, duration),
+	}
+	if err := recordOutcome(ctx, execCmd, waitErr, result); err != nil {
+		return nil, err
+	}
+	result.LimitExceeded = detectLimitExceeded(opts.Limits, execCmd, result, result.Stderr, outputExceeded.Load())
+	if opts.Hermetic {
+		result.Environment = recordedEnv(execCmd.Env, opts.Env)
 	}
 
-	return &client.TestResult{
-		ExitCode: exitCode,
-		Stdout:   stdoutBuffer.String(),
-		Stderr:   stderrBuffer.String(),
-	}, nil
+	return result, nil
 }
@@ -0,0 +1,194 @@
+package runner
+
+import (
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"io/fs"
+	"os"
+	"path"
+	"path/filepath"
+	"unicode/utf8"
+
+	"github.com/chibuka/95/client"
+)
+
+// maxArtifactBytes is how much of each collected file is attached to the
+// result, the hash and size always cover the whole file
+const maxArtifactBytes = 64 * 1024
+
+// CollectFiles records the files a test left behind. A directory collects
+// every file below it, a missing path is recorded as not existing. A path
+// that can't be collected (e.g. it leaves the test directory) is recorded
+// with the error, the other paths are still collected.
+func CollectFiles(paths []string, ws *Workspace) []client.FileArtifact {
+	var artifacts []client.FileArtifact
+	for _, p := range paths {
+		collected, err := collectPath(p, ws)
+		if err != nil {
+			collected = []client.FileArtifact{{Path: filepath.ToSlash(p), Error: err.Error()}}
+		}
+		artifacts = append(artifacts, collected...)
+	}
+	return artifacts
+}
+
+// collectPath collects one path of Test.Collect
+func collectPath(p string, ws *Workspace) ([]client.FileArtifact, error) {
+	resolved, err := ws.resolve("collect", p)
+	if err != nil {
+		return nil, err
+	}
+
+	// the program may have left a symlink, follow it but not outside. In a
+	// link sandbox, files the test didn't touch still link to the project.
+	target, err := resolveExisting(resolved)
+	if err != nil {
+		return nil, &PathViolationError{Op: "collect", Path: p, Reason: err.Error()}
+	}
+	root, err := ws.root()
+	if err != nil {
+		return nil, err
+	}
+	if !isWithin(root, target) && !ws.isSeededLink(root, resolved, target) {
+		return nil, &PathViolationError{Op: "collect", Path: p, Reason: "it links outside the test directory"}
+	}
+
+	info, err := os.Stat(target)
+	if os.IsNotExist(err) {
+		return []client.FileArtifact{{Path: filepath.ToSlash(p)}}, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to collect %s: %w", p, err)
+	}
+
+	if !info.IsDir() {
+		// reading a fifo would block until something writes to it
+		if !info.Mode().IsRegular() {
+			return []client.FileArtifact{specialFile(filepath.ToSlash(p), info.Mode())}, nil
+		}
+		artifact, err := collectFile(target, filepath.ToSlash(p))
+		if err != nil {
+			return nil, err
+		}
+		return []client.FileArtifact{artifact}, nil
+	}
+
+	// WalkDir doesn't follow links, so nothing below leads outside
+	var artifacts []client.FileArtifact
+	err = filepath.WalkDir(target, func(file string, d fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		source := file
+		if d.Type()&fs.ModeSymlink != 0 {
+			// only the untouched links of a link sandbox are followed
+			linked, err := filepath.EvalSymlinks(file)
+			if err != nil || !ws.isSeededLink(root, file, linked) {
+				return nil
+			}
+			info, err := os.Stat(linked)
+			if err != nil || !info.Mode().IsRegular() {
+				return nil
+			}
+			source = linked
+		} else if !d.Type().IsRegular() {
+			return nil
+		}
+		rel, err := filepath.Rel(target, file)
+		if err != nil {
+			return err
+		}
+		artifact, err := collectFile(source, path.Join(filepath.ToSlash(p), filepath.ToSlash(rel)))
+		if err != nil {
+			return err
+		}
+		artifacts = append(artifacts, artifact)
+		return nil
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed to collect %s: %w", p, err)
+	}
+
+	return artifacts, nil
+}
+
+// specialFile records a collected path that is not a regular file, such as
+// a named pipe, without reading it
+func specialFile(name string, mode fs.FileMode) client.FileArtifact {
+	kind := "special file"
+	switch {
+	case mode&fs.ModeNamedPipe != 0:
+		kind = "named pipe"
+	case mode&fs.ModeSocket != 0:
+		kind = "socket"
+	case mode&fs.ModeDevice != 0:
+		kind = "device"
+	}
+	return client.FileArtifact{Path: name, Exists: true, Error: "it is a " + kind + ", not a regular file"}
+}
+
+// collectFile reads a single file into an artifact
+func collectFile(file string, name string) (client.FileArtifact, error) {
+	f, err := os.Open(file)
+	if err != nil {
+		return client.FileArtifact{}, fmt.Errorf("failed to collect %s: %w", name, err)
+	}
+	defer f.Close()
+
+	h := sha256.New()
+	var head limitedBuffer
+	head.limit = maxArtifactBytes
+	size, err := io.Copy(io.MultiWriter(h, &head), f)
+	if err != nil {
+		return client.FileArtifact{}, fmt.Errorf("failed to collect %s: %w", name, err)
+	}
+
+	artifact := client.FileArtifact{
+		Path:      name,
+		Exists:    true,
+		Size:      size,
+		SHA256:    hex.EncodeToString(h.Sum(nil)),
+		Truncated: size > int64(len(head.data)),
+	}
+	// a cut can split a multi-byte character, that alone doesn't make it binary
+	text := head.data
+	if artifact.Truncated {
+		text = trimPartialRune(text)
+	}
+	if utf8.Valid(text) {
+		artifact.Content = string(text)
+	} else {
+		artifact.Content = base64.StdEncoding.EncodeToString(head.data)
+		artifact.Encoding = client.EncodingBase64
+	}
+	return artifact, nil
+}
+
+// limitedBuffer keeps the first limit bytes written to it, and accepts the rest
+type limitedBuffer struct {
+	data  []byte
+	limit int
+}
+
+func (b *limitedBuffer) Write(p []byte) (int, error) {
+	if room := b.limit - len(b.data); room > 0 {
+		b.data = append(b.data, p[:min(room, len(p))]...)
+	}
+	return len(p), nil
+}
+
+// trimPartialRune drops an incomplete UTF-8 sequence at the end of data
+func trimPartialRune(data []byte) []byte {
+	for i := 1; i < utf8.UTFMax && i <= len(data); i++ {
+		if utf8.RuneStart(data[len(data)-i]) {
+			if !utf8.FullRune(data[len(data)-i:]) {
+				return data[:len(data)-i]
+			}
+			break
+		}
+	}
+	return data
+}
@@ -0,0 +1,218 @@
+package runner
+
+import (
+	"context"
+	"fmt"
+	"maps"
+	"os"
+	"os/exec"
+	"runtime"
+	"slices"
+	"strings"
+)
+
+// Command is a parsed project run command
+type Command struct {
+	Name string
+	Args []string
+	// FOO=bar assignments written before the command name
+	Env []string
+	// The command as written in the project config
+	Raw string
+	// Run through the system shell instead of being executed directly
+	Shell bool
+}
+
+// ParseCommand parses a project run command. By default the command is split
+// with POSIX shell quoting rules and executed directly, so quoted arguments,
+// paths with spaces and FOO=bar prefixes work but shell operators are refused.
+// With useShell the command is handed to 'sh -c' as written, which allows
+// '&&' chains, pipes and variable expansion. Extra arguments are then only
+// passed on where the command uses "$@".
+func ParseCommand(runCommand string, useShell bool) (*Command, error) {
+	if strings.TrimSpace(runCommand) == "" {
+		return nil, fmt.Errorf("run command is empty")
+	}
+
+	if useShell {
+		return parseShellCommand(runCommand)
+	}
+
+	words, err := splitWords(runCommand)
+	if err != nil {
+		return nil, err
+	}
+
+	cmd := &Command{Raw: runCommand}
+	for len(words) > 0 && words[0].isAssignment() {
+		cmd.Env = append(cmd.Env, words[0].text)
+		words = words[1:]
+	}
+	if len(words) == 0 {
+		return nil, fmt.Errorf("run command %q only sets environment variables", runCommand)
+	}
+
+	cmd.Name = words[0].text
+	for _, w := range words[1:] {
+		cmd.Args = append(cmd.Args, w.text)
+	}
+	return cmd, nil
+}
+
+func parseShellCommand(runCommand string) (*Command, error) {
+	if runtime.GOOS == "windows" {
+		return &Command{Name: "cmd", Args: []string{"/C", runCommand}, Raw: runCommand, Shell: true}, nil
+	}
+
+	// -n reads the command without running it, catching syntax errors early
+	if out, err := exec.Command("sh", "-n", "-c", runCommand).CombinedOutput(); err != nil {
+		return nil, fmt.Errorf("run command is not valid shell syntax: %s", strings.TrimSpace(string(out)))
+	}
+
+	// extra arguments (e.g. from the program config) become the positional
+	// parameters, the command places them with "$@" where it needs them.
+	// Appending "$@" here would break on a trailing comment, '&' or ';'.
+	return &Command{Name: "sh", Args: []string{"-c", runCommand, "sh"}, Raw: runCommand, Shell: true}, nil
+}
+
+// command builds the process for this command with extra arguments appended
+func (c *Command) command(ctx context.Context, extraArgs ...string) *exec.Cmd {
+	args := append(append([]string{}, c.Args...), extraArgs...)
+	execCmd := exec.CommandContext(ctx, c.Name, args...)
+	execCmd.Env = append(os.Environ(), c.Env...)
+	return execCmd
+}
+
+// appendEnv adds NAME=value entries to env in a stable order. Later entries
+// win, so vars override what is already set.
+func appendEnv(env []string, vars map[string]string) []string {
+	for _, name := range slices.Sorted(maps.Keys(vars)) {
+		env = append(env, name+"="+vars[name])
+	}
+	return env
+}
+
+func (c *Command) String() string {
+	return c.Raw
+}
+
+// word is a single token of a run command
+type word struct {
+	text string
+	// the part before the first '=' was written without quotes
+	plainName bool
+}
+
+// isAssignment reports whether the word is a NAME=value environment prefix
+func (w word) isAssignment() bool {
+	name, _, found := strings.Cut(w.text, "=")
+	if !found || !w.plainName || name == "" {
+		return false
+	}
+	for i, r := range name {
+		isLetter := r == '_' || (r >= 'a' && r <= 'z') || (r >= 'A' && r <= 'Z')
+		if !isLetter && (i == 0 || r < '0' || r > '9') {
+			return false
+		}
+	}
+	return true
+}
+
+// splitWords tokenizes a command following POSIX shell quoting rules:
+// single quotes keep everything literally, double quotes and backslashes
+// escape special characters. Unquoted shell operators are rejected.
+func splitWords(s string) ([]word, error) {
+	var words []word
+	var current strings.Builder
+	inWord := false
+	quotedName := false // a quoted character appeared before the first '='
+	seenEquals := false
+
+	flush := func() {
+		if inWord {
+			words = append(words, word{text: current.String(), plainName: !quotedName})
+		}
+		current.Reset()
+		inWord, quotedName, seenEquals = false, false, false
+	}
+	quoted := func() {
+		inWord = true
+		if !seenEquals {
+			quotedName = true
+		}
+	}
+
+	for i := 0; i < len(s); i++ {
+		c := s[i]
+		switch {
+		case c == ' ' || c == '\t' || c == '\n':
+			flush()
+
+		case c == '\'':
+			end := strings.IndexByte(s[i+1:], '\'')
+			if end < 0 {
+				return nil, fmt.Errorf("run command has an unterminated single quote")
+			}
+			quoted()
+			current.WriteString(s[i+1 : i+1+end])
+			i += end + 1
+
+		case c == '"':
+			quoted()
+			i++
+			for ; i < len(s) && s[i] != '"'; i++ {
+				if s[i] == '\\' && i+1 < len(s) && strings.IndexByte("\\\"$`\n", s[i+1]) >= 0 {
+					i++
+				} else if s[i] == '$' || s[i] == '`' {
+					return nil, shellSyntaxError(s[i : i+1])
+				}
+				current.WriteByte(s[i])
+			}
+			if i == len(s) {
+				return nil, fmt.Errorf("run command has an unterminated double quote")
+			}
+
+		case c == '\\':
+			if i+1 == len(s) {
+				return nil, fmt.Errorf("run command ends with a backslash")
+			}
+			quoted()
+			i++
+			current.WriteByte(s[i])
+
+		case strings.IndexByte("|&;<>()$`*?[", c) >= 0:
+			return nil, shellSyntaxError(s[i:])
+
+		case c == '#' && !inWord:
+			return nil, shellSyntaxError("#")
+
+		case c == '~' && !inWord && (i+1 == len(s) || strings.IndexByte("/ \t\n", s[i+1]) >= 0):
+			home, err := os.UserHomeDir()
+			if err != nil {
+				return nil, fmt.Errorf("failed to expand ~: %w", err)
+			}
+			inWord = true
+			current.WriteString(home)
+
+		default:
+			if c == '=' {
+				seenEquals = true
+			}
+			inWord = true
+			current.WriteByte(c)
+		}
+	}
+	flush()
+
+	if len(words) == 0 {
+		return nil, fmt.Errorf("run command is empty")
+	}
+	return words, nil
+}
+
+func shellSyntaxError(at string) error {
+	if len(at) > 10 {
+		at = at[:10] + "..."
+	}
+	return fmt.Errorf("run command uses shell syntax at %q\n\n→ Quote it, or run '95 init --shell' to run the command through sh", at)
+}
@@ -0,0 +1,219 @@
+package runner
+
+import (
+	"runtime"
+	"slices"
+	"strings"
+	"testing"
+)
+
+func TestParseCommand(t *testing.T) {
+	home := t.TempDir()
+	t.Setenv("HOME", home)
+	t.Setenv("USERPROFILE", home)
+
+	tests := []struct {
+		name    string
+		command string
+		cmdName string
+		args    []string
+		env     []string
+		err     string
+	}{
+		{
+			name:    "plain words",
+			command: "go run .",
+			cmdName: "go",
+			args:    []string{"run", "."},
+		},
+		{
+			name:    "extra whitespace",
+			command: "  python3\tmain.py  ",
+			cmdName: "python3",
+			args:    []string{"main.py"},
+		},
+
+		// quoting
+		{
+			name:    "single quotes keep everything",
+			command: `echo 'a "b" $c \d'`,
+			cmdName: "echo",
+			args:    []string{`a "b" $c \d`},
+		},
+		{
+			name:    "double quotes escape some characters",
+			command: `echo "a \"b\" \\ \$c \d"`,
+			cmdName: "echo",
+			args:    []string{`a "b" \ $c \d`},
+		},
+		{
+			name:    "path with spaces",
+			command: `"./my app/run" --flag "two words"`,
+			cmdName: "./my app/run",
+			args:    []string{"--flag", "two words"},
+		},
+		{
+			name:    "backslash escapes",
+			command: `cat my\ file \| \;`,
+			cmdName: "cat",
+			args:    []string{"my file", "|", ";"},
+		},
+		{
+			name:    "quotes joined to a word",
+			command: `node --title='my app'x`,
+			cmdName: "node",
+			args:    []string{"--title=my appx"},
+		},
+		{
+			name:    "empty quoted argument",
+			command: `printf ''`,
+			cmdName: "printf",
+			args:    []string{""},
+		},
+		{
+			name:    "hash inside a word",
+			command: "echo a#b",
+			cmdName: "echo",
+			args:    []string{"a#b"},
+		},
+		{
+			name:    "tilde",
+			command: "~/bin/app ~ a~",
+			cmdName: home + "/bin/app",
+			args:    []string{home, "a~"},
+		},
+		{
+			name:    "unterminated single quote",
+			command: "echo 'a",
+			err:     "unterminated single quote",
+		},
+		{
+			name:    "unterminated double quote",
+			command: `echo "a`,
+			err:     "unterminated double quote",
+		},
+		{
+			name:    "trailing backslash",
+			command: `echo a\`,
+			err:     "ends with a backslash",
+		},
+
+		// environment prefixes
+		{
+			name:    "env prefixes",
+			command: "GOFLAGS=-mod=mod CGO_ENABLED=0 go run .",
+			cmdName: "go",
+			args:    []string{"run", "."},
+			env:     []string{"GOFLAGS=-mod=mod", "CGO_ENABLED=0"},
+		},
+		{
+			name:    "quoted env value",
+			command: `NAME="a b" ./app`,
+			cmdName: "./app",
+			env:     []string{"NAME=a b"},
+		},
+		{
+			name:    "assignment after the command is an argument",
+			command: "make CC=clang",
+			cmdName: "make",
+			args:    []string{"CC=clang"},
+		},
+		{
+			name:    "quoted name is not an assignment",
+			command: `"A"=1 ./app`,
+			cmdName: "A=1",
+			args:    []string{"./app"},
+		},
+		{
+			name:    "invalid name is not an assignment",
+			command: "1A=1 ./app",
+			cmdName: "1A=1",
+			args:    []string{"./app"},
+		},
+		{
+			name:    "only env prefixes",
+			command: "A=1 B=2",
+			err:     "only sets environment variables",
+		},
+
+		// shell syntax
+		{name: "empty", command: "  ", err: "run command is empty"},
+		{name: "and", command: "make && ./app", err: `shell syntax at "&& ./app"`},
+		{name: "pipe", command: "cat x | sort", err: `shell syntax at "| sort"`},
+		{name: "semicolon", command: "a; b", err: `shell syntax at "; b"`},
+		{name: "redirect", command: "app > out", err: `shell syntax at "> out"`},
+		{name: "subshell", command: "(app)", err: `shell syntax at "(app)"`},
+		{name: "variable", command: "app $HOME", err: `shell syntax at "$HOME"`},
+		{name: "variable in double quotes", command: `app "$HOME"`, err: `shell syntax at "$"`},
+		{name: "command substitution", command: "app `pwd`", err: "shell syntax at \"`pwd`\""},
+		{name: "glob", command: "app *.txt", err: `shell syntax at "*.txt"`},
+		{name: "comment", command: "app # note", err: `shell syntax at "#"`},
+		{name: "long operator", command: "app || echo failed", err: `shell syntax at "|| echo fa..."`},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			cmd, err := ParseCommand(tt.command, false)
+			if tt.err != "" {
+				if err == nil || !strings.Contains(err.Error(), tt.err) {
+					t.Fatalf("error = %v, want one containing %q", err, tt.err)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+
+			if cmd.Name != tt.cmdName {
+				t.Errorf("name = %q, want %q", cmd.Name, tt.cmdName)
+			}
+			if !slices.Equal(cmd.Args, tt.args) {
+				t.Errorf("args = %q, want %q", cmd.Args, tt.args)
+			}
+			if !slices.Equal(cmd.Env, tt.env) {
+				t.Errorf("env = %q, want %q", cmd.Env, tt.env)
+			}
+			if cmd.Raw != tt.command || cmd.Shell {
+				t.Errorf("raw = %q, shell = %v, want %q run directly", cmd.Raw, cmd.Shell, tt.command)
+			}
+		})
+	}
+}
+
+func TestParseShellCommand(t *testing.T) {
+	if runtime.GOOS == "windows" {
+		t.Skip("commands run through cmd /C, which has no syntax check")
+	}
+
+	tests := []struct {
+		name    string
+		command string
+		err     string
+	}{
+		{name: "operators", command: `make && ./app "$@" | tee out`},
+		{name: "trailing comment", command: "./app # note"},
+		{name: "unterminated quote", command: "echo 'a", err: "not valid shell syntax"},
+		{name: "dangling operator", command: "make &&", err: "not valid shell syntax"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			cmd, err := ParseCommand(tt.command, true)
+			if tt.err != "" {
+				if err == nil || !strings.Contains(err.Error(), tt.err) {
+					t.Fatalf("error = %v, want one containing %q", err, tt.err)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+
+			// the command is passed as written, extra arguments become "$@"
+			want := []string{"-c", tt.command, "sh"}
+			if cmd.Name != "sh" || !slices.Equal(cmd.Args, want) || !cmd.Shell {
+				t.Errorf("command = %q %q (shell %v), want sh %q", cmd.Name, cmd.Args, cmd.Shell, want)
+			}
+		})
+	}
+}
@@ -0,0 +1,150 @@
+package runner
+
+import (
+	"fmt"
+	"maps"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"runtime"
+	"slices"
+	"strings"
+)
+
+// hermeticPassthrough are the variables a hermetic environment keeps from the
+// developer's: where programs and toolchains are installed, which doesn't
+// change what a program prints but is needed to run it at all
+var hermeticPassthrough = []string{
+	"PATH", "TMPDIR",
+	// Windows can't start most programs without these
+	"SYSTEMROOT", "WINDIR", "COMSPEC", "PATHEXT",
+	"GOROOT", "GOPATH", "GOCACHE", "GOMODCACHE", "GOPROXY", "GOFLAGS", "GOTOOLCHAIN",
+	"CARGO_HOME", "RUSTUP_HOME", "RUSTUP_TOOLCHAIN",
+	"JAVA_HOME",
+	"VIRTUAL_ENV", "PYTHONPATH", "PYTHONUSERBASE", "PYENV_ROOT",
+	"NODE_PATH", "NVM_DIR",
+}
+
+// hermeticFixed are the variables hermetic mode sets itself
+var hermeticFixed = []string{"HOME", "USERPROFILE", "LANG", "LC_ALL", "TZ"}
+
+// hermeticLocale is the fixed locale of hermetic mode, macOS has no C.UTF-8
+func hermeticLocale() string {
+	if runtime.GOOS == "darwin" {
+		return "en_US.UTF-8"
+	}
+	return "C.UTF-8"
+}
+
+// setupEnv sets the environment of a test program: the developer's own, or a
+// minimal fixed one in hermetic mode, then the variables of the run command,
+// then vars in order, so later ones win. It returns a function removing what
+// hermetic mode created, to call once the program is done.
+func setupEnv(cmd *exec.Cmd, command *Command, opts TestOptions, vars ...map[string]string) (func(), error) {
+	cleanup := func() {}
+	if opts.Hermetic {
+		home, err := os.MkdirTemp("", "95-home-*")
+		if err != nil {
+			return nil, fmt.Errorf("failed to create home directory: %w", err)
+		}
+		cleanup = func() { _ = os.RemoveAll(home) }
+		cmd.Env = append(hermeticEnv(home), command.Env...)
+	}
+
+	for _, v := range vars {
+		cmd.Env = appendEnv(cmd.Env, v)
+	}
+	return cleanup, nil
+}
+
+// hermeticEnv is the environment every program starts from in hermetic mode:
+// toolchain locations, a fixed locale and time zone, and an empty home
+func hermeticEnv(home string) []string {
+	var env []string
+	for _, name := range hermeticPassthrough {
+		if value, ok := os.LookupEnv(name); ok {
+			env = append(env, name+"="+value)
+		}
+	}
+	env = append(env, toolchainDefaults(env)...)
+
+	locale := hermeticLocale()
+	env = append(env,
+		"HOME="+home,
+		"LANG="+locale,
+		"LC_ALL="+locale,
+		"TZ=UTC",
+	)
+	if runtime.GOOS == "windows" {
+		env = append(env, "USERPROFILE="+home)
+	}
+	return env
+}
+
+// toolchainDefaults points toolchains at the caches and packages they use
+// under the developer's real home, which they would otherwise look for under
+// the empty one: a 'go run' with a cold build cache takes ages
+func toolchainDefaults(env []string) []string {
+	home, err := os.UserHomeDir()
+	if err != nil {
+		return nil
+	}
+	cacheDir, _ := os.UserCacheDir()
+
+	defaults := []struct{ name, dir string }{
+		{"GOPATH", filepath.Join(home, "go")},
+		{"GOCACHE", filepath.Join(cacheDir, "go-build")},
+		{"CARGO_HOME", filepath.Join(home, ".cargo")},
+		{"RUSTUP_HOME", filepath.Join(home, ".rustup")},
+		{"PYTHONUSERBASE", filepath.Join(home, ".local")},
+	}
+
+	var set []string
+	for _, d := range defaults {
+		if slices.ContainsFunc(env, func(entry string) bool { return strings.HasPrefix(entry, d.name+"=") }) {
+			continue
+		}
+		if cacheDir == "" && d.name == "GOCACHE" {
+			continue
+		}
+		if info, err := os.Stat(d.dir); err == nil && info.IsDir() {
+			set = append(set, d.name+"="+d.dir)
+		}
+	}
+	return set
+}
+
+// recordedEnv is the part of a hermetic environment recorded in results: the
+// variables hermetic mode fixes and the ones vars declare, as the program
+// sees them. What is passed through from the developer's environment (a
+// GOPROXY may hold credentials) or set by the run command stays out.
+func recordedEnv(env []string, vars ...map[string]string) []string {
+	return slices.DeleteFunc(effectiveEnv(env), func(entry string) bool {
+		name, _, _ := strings.Cut(entry, "=")
+		if slices.Contains(hermeticFixed, name) {
+			return false
+		}
+		for _, v := range vars {
+			if _, ok := v[name]; ok {
+				return false
+			}
+		}
+		return true
+	})
+}
+
+// effectiveEnv resolves an environment list the way the program sees it: one
+// entry per variable, the last one set wins, sorted by name
+func effectiveEnv(env []string) []string {
+	values := make(map[string]string)
+	for _, entry := range env {
+		name, value, _ := strings.Cut(entry, "=")
+		values[name] = value
+	}
+
+	effective := make([]string, 0, len(values))
+	for _, name := range slices.Sorted(maps.Keys(values)) {
+		effective = append(effective, name+"="+values[name])
+	}
+	return effective
+}
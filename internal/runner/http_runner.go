@@ -1,13 +1,15 @@
 package runner
 
 import (
+	"context"
 	"fmt"
+	"time"
 
 	"github.com/chibuka/95/client"
 )
 
-func RunHTTPTest(programConfig *client.ProgramConfig, serverConfig *client.ServerConfig,
-	runCommand string, test client.Test) (*client.TestResult, error) {
+func RunHTTPTest(ctx context.Context, programConfig *client.ProgramConfig, serverConfig *client.ServerConfig,
+	command *Command, test client.Test, opts TestOptions) (*client.TestResult, error) {
 
 	// Check if configs are provided
 	if programConfig == nil {
@@ -17,45 +19,71 @@ func RunHTTPTest(programConfig *client.ProgramConfig, serverConfig *client.Serve
 		return nil, fmt.Errorf("server config is required for HTTP tests")
 	}
 
-	// Execute setup
-	if err := ExecuteSetup(test.Setup); err != nil {
-		return nil, fmt.Errorf("setup failed: %w", err)
-	}
-
-	// Ensure cleanup runs even if test fails
-	defer func() {
-		if test.Cleanup != nil {
-			if err := ExecuteCleanup(test.Cleanup); err != nil {
-				fmt.Printf("Warning: cleanup failed: %v\n", err)
-			}
-		}
-	}()
-
 	// Start server
 	runner := &httpServerRunner{
 		config: serverConfig,
 	}
 
-	if err := runner.startServer(programConfig, runCommand); err != nil {
-		return nil, fmt.Errorf("failed to start server: %w", err)
-	}
+	// a server that never got ready is stopped too
 	defer runner.stopServer()
+	if err := runner.startServer(ctx, programConfig, command, opts); err != nil {
+		return runner.startupFailure(test, err), nil
+	}
+
+	// a failed request still reports what the server printed up to then
+	result, err := runner.sendRequests(ctx, test)
+	if err != nil {
+		result.ExitCode = -1
+		result.Stderr = runner.requestError(err).Error()
+	}
 
+	runner.stopServer()
+	result.Usage = runner.usage
+	result.ServerOutput = runner.outputSince(outputMark{})
+	result.Environment = runner.env
+	result.ReadinessProbes = runner.probes
+	return result, nil
+}
+
+// startupFailure is the result of a test whose server didn't start, with the
+// readiness checks that were made and what the server printed
+func (h *httpServerRunner) startupFailure(test client.Test, err error) *client.TestResult {
+	result := &client.TestResult{
+		TestName:        test.TestName,
+		ExitCode:        -1,
+		Stderr:          fmt.Sprintf("failed to start server: %v", err),
+		ReadinessProbes: h.probes,
+	}
+	// nothing ran when the failure came before the process started
+	if h.exited != nil {
+		result.ServerOutput = h.outputSince(outputMark{})
+	}
+	return result
+}
+
+// sendRequests sends the requests of a test to the running server. When a
+// request fails, the result holds the responses up to it.
+func (h *httpServerRunner) sendRequests(ctx context.Context, test client.Test) (*client.TestResult, error) {
 	// Send HTTP requests and collect responses
-	var responses []client.HttpResponse
+	start := time.Now()
+	result := &client.TestResult{TestName: test.TestName}
 	for _, req := range test.HttpRequests {
-		resp, err := runner.sendRequest(req)
+		resp, err := h.sendRequest(ctx, req)
 
 		if err != nil {
+			setDuration(result, time.Since(start))
 			// Format user-friendly error message
-			reqDesc := fmt.Sprintf("%s %s", req.Method, req.Path)
-			return nil, fmt.Errorf("%s\n\n  → %s", reqDesc, formatHTTPError(err))
+			return result, fmt.Errorf("%s\n\n  → %s", req, formatHTTPError(err))
 		}
-		responses = append(responses, *resp)
+		result.HttpResponses = append(result.HttpResponses, *resp)
 	}
 
-	return &client.TestResult{
-		TestName:      test.TestName,
-		HttpResponses: responses,
-	}, nil
+	setDuration(result, time.Since(start))
+	return result, nil
+}
+
+// setDuration records how long the requests of a test took
+func setDuration(result *client.TestResult, duration time.Duration) {
+	result.DurationMs = duration.Milliseconds()
+	result.DurationUs = duration.Microseconds()
 }
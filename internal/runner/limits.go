@@ -0,0 +1,63 @@
+package runner
+
+import (
+	"os/exec"
+	"regexp"
+
+	"github.com/chibuka/95/client"
+)
+
+// defaultMaxOutputBytes caps captured output when a test sets no limit, so an
+// endless print loop can't eat all the memory of the machine
+const defaultMaxOutputBytes = 64 << 20
+
+// outputLimit is the cap on each captured output stream, in bytes
+func outputLimit(limits client.Limits) int {
+	if limits.MaxOutputKB > 0 {
+		return limits.MaxOutputKB << 10
+	}
+	return defaultMaxOutputBytes
+}
+
+// What programs print when an allocation, fork or open fails because of a limit
+var (
+	outOfMemoryPattern = regexp.MustCompile(`(?i)out of memory|cannot allocate memory|MemoryError|bad_alloc|memory allocation of \d+ bytes failed|OutOfMemoryError|allocation failed`)
+	forkFailedPattern  = regexp.MustCompile(`(?i)resource temporarily unavailable|BlockingIOError|fork: retry|cannot fork|failed to create new OS thread|pthread_create failed`)
+	tooManyFilesRegex  = regexp.MustCompile(`(?i)too many open files`)
+)
+
+// detectLimitExceeded tells which limit stopped the program, "" if none did.
+// The kernel doesn't report it, so it is told from the signal, the CPU time
+// used and the error output of the program before it died.
+func detectLimitExceeded(limits client.Limits, cmd *exec.Cmd, result *client.TestResult, errOutput string, outputExceeded bool) string {
+	if outputExceeded {
+		return client.LimitOutput
+	}
+	if !limitsSupported || result.TimedOut {
+		return ""
+	}
+
+	state := cmd.ProcessState
+	if state == nil || state.Success() {
+		return ""
+	}
+
+	if limits.CPUSeconds > 0 {
+		// SIGXCPU at the soft limit, SIGKILL at the hard one. A shell reports
+		// the signal of its child as an exit code, the time used covers both.
+		used := state.UserTime() + state.SystemTime()
+		if result.Signal == "SIGXCPU" || used.Seconds() >= float64(limits.CPUSeconds) {
+			return client.LimitCPU
+		}
+	}
+
+	switch {
+	case limits.MemoryMB > 0 && outOfMemoryPattern.MatchString(errOutput):
+		return client.LimitMemory
+	case limits.MaxProcesses > 0 && forkFailedPattern.MatchString(errOutput):
+		return client.LimitProcesses
+	case limits.MaxOpenFiles > 0 && tooManyFilesRegex.MatchString(errOutput):
+		return client.LimitOpenFiles
+	}
+	return ""
+}
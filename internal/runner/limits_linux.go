@@ -0,0 +1,141 @@
+package runner
+
+import (
+	"bufio"
+	"fmt"
+	"os"
+	"strconv"
+	"strings"
+
+	"github.com/chibuka/95/client"
+	"golang.org/x/sys/unix"
+)
+
+// limitsSupported is whether limits other than the output size are enforced
+// on this platform
+const limitsSupported = true
+
+// rlimitNames are the resources the shim understands, see RunShim
+var rlimitNames = map[string]int{
+	"as":     unix.RLIMIT_AS,
+	"cpu":    unix.RLIMIT_CPU,
+	"nproc":  unix.RLIMIT_NPROC,
+	"nofile": unix.RLIMIT_NOFILE,
+}
+
+// limitSpec renders the resource limits for the shim, which sets them before
+// the program runs. Setting them after the start would race with the program
+// forking children that don't inherit them.
+func limitSpec(limits client.Limits) ([]string, error) {
+	var spec []string
+
+	if limits.MemoryMB > 0 {
+		spec = append(spec, formatRlimit("as", uint64(limits.MemoryMB)<<20, 0))
+	}
+	if limits.CPUSeconds > 0 {
+		// SIGXCPU at the soft limit, SIGKILL a second later for programs that catch it
+		spec = append(spec, formatRlimit("cpu", uint64(limits.CPUSeconds), 1))
+	}
+	if limits.MaxProcesses > 0 {
+		// RLIMIT_NPROC counts every process and thread of the user, not
+		// just the ones of the program, so the limit is on top of those
+		running, err := countUserTasks(os.Getuid())
+		if err != nil {
+			return nil, fmt.Errorf("process limit: %w", err)
+		}
+		spec = append(spec, formatRlimit("nproc", uint64(running+limits.MaxProcesses), 0))
+	}
+	if limits.MaxOpenFiles > 0 {
+		spec = append(spec, formatRlimit("nofile", uint64(limits.MaxOpenFiles), 0))
+	}
+
+	return spec, nil
+}
+
+// formatRlimit renders one limit for the shim: the soft limit, and the hard
+// limit slack above it
+func formatRlimit(name string, value uint64, slack uint64) string {
+	return fmt.Sprintf("%s=%d:%d", name, value, value+slack)
+}
+
+// setRlimit applies one limit rendered by limitSpec to the current process.
+// Limits can't go above the current hard limit without privileges.
+func setRlimit(item string) error {
+	name, values, _ := strings.Cut(item, "=")
+	soft, hard, _ := strings.Cut(values, ":")
+
+	resource, ok := rlimitNames[name]
+	if !ok {
+		return fmt.Errorf("unknown limit %q", name)
+	}
+	cur, err := strconv.ParseUint(soft, 10, 64)
+	if err != nil {
+		return fmt.Errorf("invalid %s limit: %w", name, err)
+	}
+	max, err := strconv.ParseUint(hard, 10, 64)
+	if err != nil {
+		return fmt.Errorf("invalid %s limit: %w", name, err)
+	}
+
+	var current unix.Rlimit
+	if err := unix.Getrlimit(resource, &current); err != nil {
+		return err
+	}
+	limit := unix.Rlimit{Cur: min(cur, current.Max), Max: min(max, current.Max)}
+	if err := unix.Setrlimit(resource, &limit); err != nil {
+		return fmt.Errorf("failed to set %s limit: %w", name, err)
+	}
+	return nil
+}
+
+// countUserTasks counts the threads of every process owned by uid
+func countUserTasks(uid int) (int, error) {
+	entries, err := os.ReadDir("/proc")
+	if err != nil {
+		return 0, err
+	}
+
+	count := 0
+	for _, entry := range entries {
+		if _, err := strconv.Atoi(entry.Name()); err != nil {
+			continue
+		}
+		owner, threads, ok := readTaskStatus("/proc/" + entry.Name() + "/status")
+		if ok && owner == uid {
+			count += threads
+		}
+	}
+	return count, nil
+}
+
+// readTaskStatus reads the real uid and thread count of a process
+func readTaskStatus(path string) (uid int, threads int, ok bool) {
+	f, err := os.Open(path)
+	if err != nil {
+		// the process exited while we were looking
+		return 0, 0, false
+	}
+	defer f.Close()
+
+	found := 0
+	scanner := bufio.NewScanner(f)
+	for scanner.Scan() && found < 2 {
+		name, value, _ := strings.Cut(scanner.Text(), ":")
+		fields := strings.Fields(value)
+		if len(fields) == 0 {
+			continue
+		}
+		switch name {
+		case "Uid":
+			uid, err = strconv.Atoi(fields[0])
+			found++
+		case "Threads":
+			threads, err = strconv.Atoi(fields[0])
+			found++
+		}
+		if err != nil {
+			return 0, 0, false
+		}
+	}
+	return uid, threads, found == 2
+}
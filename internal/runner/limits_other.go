@@ -0,0 +1,7 @@
+//go:build !linux
+
+package runner
+
+// limitsSupported is whether limits other than the output size are enforced
+// on this platform
+const limitsSupported = false
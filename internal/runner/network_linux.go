@@ -0,0 +1,90 @@
+package runner
+
+import (
+	"fmt"
+	"os"
+	"os/exec"
+	"strings"
+	"sync"
+	"syscall"
+
+	"golang.org/x/sys/unix"
+)
+
+var (
+	networkCheckOnce sync.Once
+	networkCheckErr  error
+)
+
+// isolateNetwork makes cmd start in a new network namespace, which only has
+// a loopback interface, down until the shim brings it up. Without root a user
+// namespace mapping the current user is created too, since that's what lets
+// an unprivileged process create the network namespace. The shim keeps
+// CAP_NET_ADMIN in it just long enough to bring loopback up.
+func isolateNetwork(cmd *exec.Cmd) {
+	if cmd.SysProcAttr == nil {
+		cmd.SysProcAttr = &syscall.SysProcAttr{}
+	}
+	attr := cmd.SysProcAttr
+	attr.Cloneflags |= syscall.CLONE_NEWNET
+
+	if os.Geteuid() == 0 {
+		return
+	}
+	attr.Cloneflags |= syscall.CLONE_NEWUSER
+	attr.UidMappings = []syscall.SysProcIDMap{{ContainerID: os.Geteuid(), HostID: os.Geteuid(), Size: 1}}
+	attr.GidMappings = []syscall.SysProcIDMap{{ContainerID: os.Getegid(), HostID: os.Getegid(), Size: 1}}
+	attr.GidMappingsEnableSetgroups = false
+	attr.AmbientCaps = []uintptr{unix.CAP_NET_ADMIN}
+}
+
+// setupNetwork runs in the shim, inside the new network namespace: it brings
+// the loopback interface up so programs can still talk to themselves, then
+// drops the capability it needed, the program runs without it
+func setupNetwork() error {
+	fd, err := unix.Socket(unix.AF_INET, unix.SOCK_DGRAM|unix.SOCK_CLOEXEC, 0)
+	if err != nil {
+		return fmt.Errorf("failed to set up loopback: %w", err)
+	}
+	defer unix.Close(fd)
+
+	ifreq, err := unix.NewIfreq("lo")
+	if err != nil {
+		return fmt.Errorf("failed to set up loopback: %w", err)
+	}
+	if err := unix.IoctlIfreq(fd, unix.SIOCGIFFLAGS, ifreq); err != nil {
+		return fmt.Errorf("failed to set up loopback: %w", err)
+	}
+	ifreq.SetUint16(ifreq.Uint16() | unix.IFF_UP)
+	if err := unix.IoctlIfreq(fd, unix.SIOCSIFFLAGS, ifreq); err != nil {
+		return fmt.Errorf("failed to set up loopback: %w", err)
+	}
+
+	if err := unix.Prctl(unix.PR_CAP_AMBIENT, unix.PR_CAP_AMBIENT_CLEAR_ALL, 0, 0, 0); err != nil {
+		return fmt.Errorf("failed to drop capabilities: %w", err)
+	}
+	return nil
+}
+
+// CheckNetworkIsolation reports whether programs can be started without
+// network access, by starting the shim in an isolated network once. Many
+// containers and hardened kernels don't allow unprivileged user namespaces.
+func CheckNetworkIsolation() error {
+	networkCheckOnce.Do(func() {
+		self, err := os.Executable()
+		if err != nil {
+			networkCheckErr = fmt.Errorf("failed to locate the 95 executable: %w", err)
+			return
+		}
+
+		cmd := exec.Command(self, ShimCommand, networkSpec)
+		isolateNetwork(cmd)
+		if output, err := cmd.CombinedOutput(); err != nil {
+			if msg := strings.TrimSpace(string(output)); msg != "" {
+				err = fmt.Errorf("%w: %s", err, msg)
+			}
+			networkCheckErr = fmt.Errorf("network namespaces are unavailable: %w", err)
+		}
+	})
+	return networkCheckErr
+}
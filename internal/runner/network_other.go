@@ -0,0 +1,11 @@
+//go:build !linux
+
+package runner
+
+import "fmt"
+
+// CheckNetworkIsolation reports that programs can't be started without
+// network access, it relies on Linux namespaces
+func CheckNetworkIsolation() error {
+	return fmt.Errorf("it needs Linux network namespaces")
+}
@@ -0,0 +1,22 @@
+package runner
+
+import "github.com/chibuka/95/client"
+
+// TestOptions are the per-test settings the program is run with
+type TestOptions struct {
+	// Working directory of the program, see Workspace
+	Dir string
+	// How stdin is fed to the program for CLI tests
+	Interactive client.InteractiveConfig
+	// Extra environment variables, they override the inherited ones
+	Env map[string]string
+	// Resource limits, zero fields are unlimited
+	Limits client.Limits
+	// Start from a minimal fixed environment instead of the developer's,
+	// see hermeticEnv
+	Hermetic bool
+	// Start CLI programs in a network of their own with only loopback, see
+	// isolateNetwork. HTTP servers keep the host's network so they can be
+	// reached.
+	NoNetwork bool
+}
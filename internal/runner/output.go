@@ -0,0 +1,110 @@
+package runner
+
+import (
+	"bytes"
+	"context"
+	"sync"
+	"time"
+)
+
+// outputRecorder collects program output while it is running and remembers
+// when the program last wrote something, so input can be paced against it
+type outputRecorder struct {
+	mu        sync.Mutex
+	buf       bytes.Buffer
+	lastWrite time.Time
+
+	// limit caps the recorded output in bytes, 0 means no cap
+	limit      int
+	onOverflow func()
+	overflowed bool
+}
+
+// setLimit caps the recorded output. Output past the cap is dropped and
+// onOverflow is called once, it may be nil.
+func (o *outputRecorder) setLimit(limit int, onOverflow func()) {
+	o.mu.Lock()
+	defer o.mu.Unlock()
+	o.limit = limit
+	o.onOverflow = onOverflow
+}
+
+func (o *outputRecorder) Write(p []byte) (int, error) {
+	o.mu.Lock()
+	o.lastWrite = time.Now()
+
+	if o.limit == 0 || o.buf.Len()+len(p) <= o.limit {
+		defer o.mu.Unlock()
+		return o.buf.Write(p)
+	}
+
+	// the program still sees a successful write, it is stopped instead
+	o.buf.Write(p[:max(o.limit-o.buf.Len(), 0)])
+	notify := !o.overflowed && o.onOverflow != nil
+	o.overflowed = true
+	o.mu.Unlock()
+
+	if notify {
+		o.onOverflow()
+	}
+	return len(p), nil
+}
+
+func (o *outputRecorder) String() string {
+	o.mu.Lock()
+	defer o.mu.Unlock()
+	return o.buf.String()
+}
+
+// Len is the length of the output recorded so far
+func (o *outputRecorder) Len() int {
+	o.mu.Lock()
+	defer o.mu.Unlock()
+	return o.buf.Len()
+}
+
+// slice returns the output between two offsets returned by waitReady
+func (o *outputRecorder) slice(from, to int) string {
+	o.mu.Lock()
+	defer o.mu.Unlock()
+	return string(o.buf.Bytes()[from:to])
+}
+
+// waitReady blocks until the program looks ready for more input: the output
+// written after offset ends with the prompt, or the program has been silent
+// for the quiet period. It also returns when the program exits or the context
+// is done. The returned value is the length of the output at that moment.
+func (o *outputRecorder) waitReady(ctx context.Context, offset int, prompt string, quiet time.Duration, exited <-chan struct{}) int {
+	start := time.Now()
+	ticker := time.NewTicker(10 * time.Millisecond)
+	defer ticker.Stop()
+
+	for {
+		o.mu.Lock()
+		out := o.buf.Bytes()
+		n := len(out)
+		promptSeen := prompt != "" && bytes.HasSuffix(out[offset:], []byte(prompt))
+		last := o.lastWrite
+		o.mu.Unlock()
+
+		if promptSeen {
+			return n
+		}
+		if last.Before(start) {
+			last = start
+		}
+		if time.Since(last) >= quiet {
+			return n
+		}
+
+		select {
+		case <-ctx.Done():
+			return n
+		case <-exited:
+			o.mu.Lock()
+			defer o.mu.Unlock()
+			return o.buf.Len()
+		case <-ticker.C:
+		}
+	}
+}
@@ -0,0 +1,210 @@
+package runner
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+
+	"github.com/chibuka/95/client"
+)
+
+// PathViolationError is returned when a setup or cleanup path would reach
+// outside the test working directory, or delete files tracked by git
+// (including when git can't tell)
+type PathViolationError struct {
+	Op     string // what the test config asked for, e.g. "delete file"
+	Path   string // the path as written in the test config
+	Reason string
+}
+
+func (e *PathViolationError) Error() string {
+	return fmt.Sprintf("refusing to %s %q: %s", e.Op, e.Path, e.Reason)
+}
+
+// resolve turns a setup or cleanup path into an absolute path inside the
+// workspace. Symlinks in the parent directories are followed so a link can't
+// lead outside the workspace. The last element itself is not followed:
+// deleting or replacing a symlink never touches what it points to.
+func (w *Workspace) resolve(op string, path string) (string, error) {
+	violation := func(reason string) error {
+		return &PathViolationError{Op: op, Path: path, Reason: reason}
+	}
+
+	if path == "" {
+		return "", violation("path is empty")
+	}
+	if filepath.IsAbs(path) || filepath.VolumeName(path) != "" {
+		return "", violation("absolute paths are not allowed")
+	}
+
+	root, err := w.root()
+	if err != nil {
+		return "", err
+	}
+
+	full := filepath.Join(root, path)
+	if full == root {
+		return "", violation("path is the test directory itself")
+	}
+	if !isWithin(root, full) {
+		return "", violation("path escapes the test directory")
+	}
+
+	parent, err := resolveExisting(filepath.Dir(full))
+	if err != nil {
+		return "", violation(err.Error())
+	}
+	if !isWithin(root, parent) {
+		return "", violation("path goes through a symlink that leaves the test directory")
+	}
+
+	return filepath.Join(parent, filepath.Base(full)), nil
+}
+
+// resolveForDelete is resolve plus a check that the path isn't tracked by
+// git, so a test config can't delete project sources
+func (w *Workspace) resolveForDelete(op string, path string) (string, error) {
+	resolved, err := w.resolve(op, path)
+	if err != nil {
+		return "", err
+	}
+
+	// sandboxes are thrown away, deleting their copies is harmless
+	if w.Sandbox || w.AllowTrackedDeletes {
+		return resolved, nil
+	}
+
+	tracked, err := isTracked(w.Dir, resolved)
+	if err != nil {
+		return "", &PathViolationError{
+			Op:     op,
+			Path:   path,
+			Reason: fmt.Sprintf("can't tell whether git tracks it: %v (use --allow-tracked-deletes or --sandbox)", err),
+		}
+	}
+	if tracked {
+		return "", &PathViolationError{
+			Op:     op,
+			Path:   path,
+			Reason: "files tracked by git would be deleted (use --allow-tracked-deletes or --sandbox)",
+		}
+	}
+
+	return resolved, nil
+}
+
+// checkLinkTarget makes sure a symlink created at path (already resolved)
+// points inside the workspace, following any links along the way
+func (w *Workspace) checkLinkTarget(path string, link client.SymlinkCreation) error {
+	violation := func(reason string) error {
+		return &PathViolationError{Op: "create symlink", Path: link.Path, Reason: reason}
+	}
+
+	if link.Target == "" {
+		return violation("target is empty")
+	}
+	if filepath.IsAbs(link.Target) || filepath.VolumeName(link.Target) != "" {
+		return violation("absolute targets are not allowed")
+	}
+
+	root, err := w.root()
+	if err != nil {
+		return err
+	}
+
+	target, err := resolveExisting(filepath.Join(filepath.Dir(path), link.Target))
+	if err != nil {
+		return violation(err.Error())
+	}
+	if !isWithin(root, target) {
+		return violation("target " + link.Target + " is outside the test directory")
+	}
+	return nil
+}
+
+// root is the workspace directory with symlinks resolved, what paths are
+// compared against
+func (w *Workspace) root() (string, error) {
+	root, err := filepath.EvalSymlinks(w.Dir)
+	if err != nil {
+		return "", fmt.Errorf("failed to resolve test directory: %w", err)
+	}
+	return root, nil
+}
+
+// resolveExisting follows symlinks in the longest existing prefix of path,
+// the parts that don't exist yet are kept as they are
+func resolveExisting(path string) (string, error) {
+	rest := ""
+	for {
+		resolved, err := filepath.EvalSymlinks(path)
+		if err == nil {
+			return filepath.Join(resolved, rest), nil
+		}
+		if !os.IsNotExist(err) {
+			return "", err
+		}
+		// a dangling link would be followed when creating files below it
+		if info, lerr := os.Lstat(path); lerr == nil && info.Mode()&os.ModeSymlink != 0 {
+			return "", fmt.Errorf("%s is a dangling symlink", filepath.Base(path))
+		}
+
+		parent := filepath.Dir(path)
+		if parent == path {
+			return filepath.Join(path, rest), nil
+		}
+		rest = filepath.Join(filepath.Base(path), rest)
+		path = parent
+	}
+}
+
+// isWithin reports whether path is root or below it
+func isWithin(root string, path string) bool {
+	rel, err := filepath.Rel(root, path)
+	if err != nil {
+		return false
+	}
+	return rel != ".." && !strings.HasPrefix(rel, ".."+string(filepath.Separator))
+}
+
+// isTracked reports whether git tracks path, or any file below it. Outside
+// a git repository nothing is tracked. When git fails inside one, or isn't
+// installed, the answer is unknown and an error.
+func isTracked(root string, path string) (bool, error) {
+	out, err := exec.Command("git", "-C", root, "ls-files", "--", path).Output()
+
+	var exitErr *exec.ExitError
+	switch {
+	case err == nil:
+		return len(bytes.TrimSpace(out)) > 0, nil
+	case !inGitRepository(root):
+		// a broken .git is reported as "not a git repository" too,
+		// only trust that answer when there is no .git at all
+		return false, nil
+	case errors.Is(err, exec.ErrNotFound):
+		return false, fmt.Errorf("git is not installed")
+	case errors.As(err, &exitErr):
+		return false, fmt.Errorf("git ls-files failed: %s", strings.TrimSpace(string(exitErr.Stderr)))
+	default:
+		return false, fmt.Errorf("failed to run git: %w", err)
+	}
+}
+
+// inGitRepository reports whether dir or one of its parents has a .git
+// entry, for when git itself can't be asked
+func inGitRepository(dir string) bool {
+	for {
+		if _, err := os.Lstat(filepath.Join(dir, ".git")); err == nil {
+			return true
+		}
+		parent := filepath.Dir(dir)
+		if parent == dir {
+			return false
+		}
+		dir = parent
+	}
+}
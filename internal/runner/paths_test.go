@@ -0,0 +1,168 @@
+package runner
+
+import (
+	"errors"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+// writeFile creates a file below dir, with its parent directories
+func writeFile(t *testing.T, dir, path string) {
+	t.Helper()
+	full := filepath.Join(dir, filepath.FromSlash(path))
+	if err := os.MkdirAll(filepath.Dir(full), 0o755); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(full, []byte(path), 0o644); err != nil {
+		t.Fatal(err)
+	}
+}
+
+// symlink creates a link, skipping the test where the OS doesn't let it
+func symlink(t *testing.T, target, link string) {
+	t.Helper()
+	if err := os.Symlink(target, link); err != nil {
+		t.Skipf("can't create symlinks: %v", err)
+	}
+}
+
+func TestWorkspaceResolve(t *testing.T) {
+	dir := t.TempDir()
+	outside := t.TempDir()
+	writeFile(t, dir, "sub/file.txt")
+	symlink(t, "sub", filepath.Join(dir, "inside"))
+	symlink(t, outside, filepath.Join(dir, "outside"))
+	// both temporary directories share a parent
+	symlink(t, filepath.Join("..", "..", filepath.Base(outside)), filepath.Join(dir, "sub", "up"))
+	symlink(t, "missing", filepath.Join(dir, "dangling"))
+
+	root, err := filepath.EvalSymlinks(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	ws := &Workspace{Dir: dir}
+
+	tests := []struct {
+		name string
+		path string
+		want string // relative to the workspace, slash separated
+		err  string
+	}{
+		{name: "file", path: "a.txt", want: "a.txt"},
+		{name: "nested file that doesn't exist yet", path: "new/dir/a.txt", want: "new/dir/a.txt"},
+		{name: "existing file", path: "sub/file.txt", want: "sub/file.txt"},
+		{name: "dot dot that stays inside", path: "sub/../a.txt", want: "a.txt"},
+		{name: "dot dot out", path: "../a.txt", err: "path escapes the test directory"},
+		{name: "dot dot out from below", path: "sub/../../a.txt", err: "path escapes the test directory"},
+		{name: "dot dot to a sibling", path: "../" + filepath.Base(dir) + "x/a.txt", err: "path escapes the test directory"},
+		{name: "the directory itself", path: ".", err: "path is the test directory itself"},
+		{name: "the directory itself through dot dot", path: "sub/..", err: "path is the test directory itself"},
+		{name: "empty", path: "", err: "path is empty"},
+		{name: "absolute", path: filepath.Join(outside, "a.txt"), err: "absolute paths are not allowed"},
+		{name: "symlink inside", path: "inside/a.txt", want: "sub/a.txt"},
+		{name: "symlink out", path: "outside/a.txt", err: "symlink that leaves the test directory"},
+		{name: "nested symlink out", path: "sub/up/a.txt", err: "symlink that leaves the test directory"},
+		{name: "symlink out itself is not followed", path: "outside", want: "outside"},
+		{name: "dangling symlink", path: "dangling/a.txt", err: "dangling is a dangling symlink"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := ws.resolve("delete file", tt.path)
+			if tt.err != "" {
+				var violation *PathViolationError
+				if !errors.As(err, &violation) || !strings.Contains(violation.Reason, tt.err) {
+					t.Fatalf("error = %v, want a path violation containing %q", err, tt.err)
+				}
+				if violation.Path != tt.path || violation.Op != "delete file" {
+					t.Errorf("violation is about %s %q, want delete file %q", violation.Op, violation.Path, tt.path)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			if want := filepath.Join(root, filepath.FromSlash(tt.want)); got != want {
+				t.Errorf("resolved to %q, want %q", got, want)
+			}
+		})
+	}
+}
+
+func TestWorkspaceResolveForDelete(t *testing.T) {
+	if _, err := exec.LookPath("git"); err != nil {
+		t.Skip("git is not installed")
+	}
+
+	// a repository with tracked and untracked files, its index is enough
+	repo := t.TempDir()
+	git := func(args ...string) {
+		t.Helper()
+		cmd := exec.Command("git", append([]string{"-C", repo}, args...)...)
+		if out, err := cmd.CombinedOutput(); err != nil {
+			t.Fatalf("git %s: %v\n%s", strings.Join(args, " "), err, out)
+		}
+	}
+	git("init", "-q")
+	writeFile(t, repo, "tracked.txt")
+	writeFile(t, repo, "src/main.go")
+	writeFile(t, repo, "untracked.txt")
+	writeFile(t, repo, "build/out.bin")
+	git("add", "tracked.txt", "src/main.go")
+
+	plain := t.TempDir()
+	writeFile(t, plain, "a.txt")
+
+	// git says "not a git repository" for a broken .git too
+	broken := t.TempDir()
+	writeFile(t, broken, "a.txt")
+	if err := os.WriteFile(filepath.Join(broken, ".git"), []byte("gitdir: missing\n"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		name  string
+		ws    *Workspace
+		path  string
+		noGit bool   // git can't be found
+		err   string // empty when the delete is allowed
+	}{
+		{name: "untracked file", ws: &Workspace{Dir: repo}, path: "untracked.txt"},
+		{name: "untracked directory", ws: &Workspace{Dir: repo}, path: "build"},
+		{name: "file that doesn't exist", ws: &Workspace{Dir: repo}, path: "missing.txt"},
+		{name: "tracked file", ws: &Workspace{Dir: repo}, path: "tracked.txt", err: "files tracked by git would be deleted"},
+		{name: "directory with tracked files", ws: &Workspace{Dir: repo}, path: "src", err: "files tracked by git would be deleted"},
+		{name: "tracked file through dot dot", ws: &Workspace{Dir: repo}, path: "build/../tracked.txt", err: "files tracked by git would be deleted"},
+		{name: "tracked file in a sandbox", ws: &Workspace{Dir: repo, Sandbox: true}, path: "tracked.txt"},
+		{name: "tracked file with deletes allowed", ws: &Workspace{Dir: repo, AllowTrackedDeletes: true}, path: "tracked.txt"},
+		{name: "escaping path with deletes allowed", ws: &Workspace{Dir: repo, AllowTrackedDeletes: true}, path: "../a.txt", err: "path escapes the test directory"},
+		{name: "outside a repository", ws: &Workspace{Dir: plain}, path: "a.txt"},
+		{name: "outside a repository without git", ws: &Workspace{Dir: plain}, path: "a.txt", noGit: true},
+		{name: "broken repository", ws: &Workspace{Dir: broken}, path: "a.txt", err: "can't tell whether git tracks it"},
+		{name: "repository without git", ws: &Workspace{Dir: repo}, path: "untracked.txt", noGit: true, err: "git is not installed"},
+		{name: "sandbox without git", ws: &Workspace{Dir: repo, Sandbox: true}, path: "tracked.txt", noGit: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if tt.noGit {
+				t.Setenv("PATH", t.TempDir())
+			}
+
+			_, err := tt.ws.resolveForDelete("delete file", tt.path)
+			if tt.err == "" {
+				if err != nil {
+					t.Fatalf("unexpected error: %v", err)
+				}
+				return
+			}
+			var violation *PathViolationError
+			if !errors.As(err, &violation) || !strings.Contains(violation.Reason, tt.err) {
+				t.Fatalf("error = %v, want a path violation containing %q", err, tt.err)
+			}
+		})
+	}
+}
@@ -0,0 +1,45 @@
+package runner
+
+import (
+	"fmt"
+	"net"
+	"strconv"
+	"strings"
+)
+
+// portPlaceholder is replaced by the server port in the program arguments
+const portPlaceholder = "{port}"
+
+// checkPortFree fails when something already listens on port, naming the
+// process when it can be found. Otherwise the server can't start, and the
+// tests would reach the other process instead, e.g. one left over from an
+// earlier run.
+func checkPortFree(port int) error {
+	listener, err := net.Listen("tcp", ":"+strconv.Itoa(port))
+	if err == nil {
+		return listener.Close()
+	}
+	if owner := portOwner(port); owner != "" {
+		return fmt.Errorf("port %d is already in use by %s", port, owner)
+	}
+	return fmt.Errorf("port %d is not available: %w", port, err)
+}
+
+// freePort asks the system for a port nothing listens on
+func freePort() (int, error) {
+	listener, err := net.Listen("tcp", ":0")
+	if err != nil {
+		return 0, fmt.Errorf("failed to find a free port: %w", err)
+	}
+	defer listener.Close()
+	return listener.Addr().(*net.TCPAddr).Port, nil
+}
+
+// withPort replaces the port placeholder in the program arguments
+func withPort(args []string, port int) []string {
+	replaced := make([]string, len(args))
+	for i, arg := range args {
+		replaced[i] = strings.ReplaceAll(arg, portPlaceholder, strconv.Itoa(port))
+	}
+	return replaced
+}
@@ -0,0 +1,9 @@
+//go:build !linux
+
+package runner
+
+// portOwner returns "", listening sockets are only traced to processes on
+// Linux
+func portOwner(port int) string {
+	return ""
+}
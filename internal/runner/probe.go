@@ -0,0 +1,235 @@
+package runner
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"net"
+	"net/http"
+	"regexp"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/chibuka/95/client"
+)
+
+// Readiness probe defaults
+const (
+	defaultProbeInterval    = 200 * time.Millisecond
+	defaultProbeMaxInterval = 2 * time.Second
+	// how long a single HTTP request or TCP connect may take
+	probeTimeout = 500 * time.Millisecond
+	// lines longer than this are not matched by log probes
+	maxProbeLineBytes = 64 << 10
+	// groups of attempts listed when a server never got ready
+	maxProbeGroups = 10
+)
+
+// readinessProbe is the readiness probe of a server config, defaults filled in
+type readinessProbe struct {
+	kind        string
+	path        string
+	status      int
+	pattern     *regexp.Regexp
+	interval    time.Duration
+	backoff     float64
+	maxInterval time.Duration
+
+	// closed once a log probe saw its line, matchedLine is set then
+	matched     chan struct{}
+	matchOnce   sync.Once
+	matchedLine string
+}
+
+// newReadinessProbe checks a probe config and fills in the defaults, nil
+// means the default probe
+func newReadinessProbe(config *client.ReadinessProbe) (*readinessProbe, error) {
+	probe := &readinessProbe{
+		kind:        client.ProbeHTTP,
+		path:        "/",
+		interval:    defaultProbeInterval,
+		backoff:     1,
+		maxInterval: defaultProbeMaxInterval,
+	}
+	if config == nil {
+		return probe, nil
+	}
+
+	if config.Type != "" {
+		probe.kind = config.Type
+	}
+	switch probe.kind {
+	case client.ProbeHTTP, client.ProbeTCP:
+	case client.ProbeLog:
+		if config.Pattern == "" {
+			return nil, fmt.Errorf("log readiness probe needs a pattern")
+		}
+		pattern, err := regexp.Compile(config.Pattern)
+		if err != nil {
+			return nil, fmt.Errorf("invalid readiness pattern: %w", err)
+		}
+		probe.pattern = pattern
+		probe.matched = make(chan struct{})
+	default:
+		return nil, fmt.Errorf("unknown readiness probe type %q", probe.kind)
+	}
+
+	if config.Path != "" {
+		probe.path = config.Path
+	}
+	probe.status = config.Status
+	if config.IntervalMs > 0 {
+		probe.interval = time.Duration(config.IntervalMs) * time.Millisecond
+	}
+	if config.Backoff > 1 {
+		probe.backoff = config.Backoff
+	}
+	if config.MaxIntervalMs > 0 {
+		probe.maxInterval = time.Duration(config.MaxIntervalMs) * time.Millisecond
+	}
+	probe.maxInterval = max(probe.maxInterval, probe.interval)
+	return probe, nil
+}
+
+// String describes what the probe waits for
+func (p *readinessProbe) String() string {
+	switch p.kind {
+	case client.ProbeTCP:
+		return "a connection to be accepted"
+	case client.ProbeLog:
+		return fmt.Sprintf("a line matching /%s/", p.pattern)
+	}
+	if p.status != 0 {
+		return fmt.Sprintf("GET %s to answer %d", p.path, p.status)
+	}
+	return fmt.Sprintf("GET %s to answer", p.path)
+}
+
+// check runs the probe once against the server on port
+func (p *readinessProbe) check(ctx context.Context, port int) (bool, string) {
+	switch p.kind {
+	case client.ProbeTCP:
+		dialer := net.Dialer{Timeout: probeTimeout}
+		conn, err := dialer.DialContext(ctx, "tcp", net.JoinHostPort("localhost", strconv.Itoa(port)))
+		if err != nil {
+			return false, describeProbeError(err)
+		}
+		conn.Close()
+		return true, "connected"
+
+	case client.ProbeLog:
+		select {
+		case <-p.matched:
+			return true, "printed " + strconv.Quote(p.matchedLine)
+		default:
+			return false, "no matching line yet"
+		}
+	}
+
+	reqCtx, cancel := context.WithTimeout(ctx, probeTimeout)
+	defer cancel()
+	req, err := http.NewRequestWithContext(reqCtx, "GET", fmt.Sprintf("http://localhost:%d%s", port, p.path), nil)
+	if err != nil {
+		return false, err.Error()
+	}
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		return false, describeProbeError(err)
+	}
+	resp.Body.Close()
+
+	if p.status != 0 && resp.StatusCode != p.status {
+		return false, fmt.Sprintf("HTTP %d, expected %d", resp.StatusCode, p.status)
+	}
+	return true, fmt.Sprintf("HTTP %d", resp.StatusCode)
+}
+
+// describeProbeError keeps the part of a connection error that tells what
+// happened, like "connection refused"
+func describeProbeError(err error) string {
+	var netErr net.Error
+	if errors.As(err, &netErr) && netErr.Timeout() {
+		return fmt.Sprintf("no answer within %s", probeTimeout)
+	}
+	for {
+		inner := errors.Unwrap(err)
+		if inner == nil {
+			return err.Error()
+		}
+		err = inner
+	}
+}
+
+// watch returns a writer matching the lines of one output stream of the
+// server against a log probe
+func (p *readinessProbe) watch() *lineMatcher {
+	return &lineMatcher{probe: p}
+}
+
+// lineMatcher splits a stream into lines for a log probe
+type lineMatcher struct {
+	probe   *readinessProbe
+	mu      sync.Mutex
+	partial []byte
+}
+
+func (m *lineMatcher) Write(p []byte) (int, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	m.partial = append(m.partial, p...)
+	for {
+		i := bytes.IndexByte(m.partial, '\n')
+		if i < 0 {
+			break
+		}
+		line := strings.TrimRight(string(m.partial[:i]), "\r")
+		m.partial = m.partial[i+1:]
+		if m.probe.pattern.MatchString(line) {
+			m.probe.matchOnce.Do(func() {
+				m.probe.matchedLine = line
+				close(m.probe.matched)
+			})
+		}
+	}
+	if len(m.partial) > maxProbeLineBytes {
+		m.partial = nil
+	}
+	return len(p), nil
+}
+
+// describeAttempts lists probe attempts for a server that never got ready,
+// runs of attempts with the same result on one line
+func describeAttempts(attempts []client.ProbeAttempt) string {
+	type group struct {
+		from, to int64
+		result   string
+		count    int
+	}
+	var groups []group
+	for _, attempt := range attempts {
+		if n := len(groups); n > 0 && groups[n-1].result == attempt.Result {
+			groups[n-1].to = attempt.ElapsedMs
+			groups[n-1].count++
+			continue
+		}
+		groups = append(groups, group{attempt.ElapsedMs, attempt.ElapsedMs, attempt.Result, 1})
+	}
+
+	var out strings.Builder
+	if len(groups) > maxProbeGroups {
+		out.WriteString("  …\n")
+		groups = groups[len(groups)-maxProbeGroups:]
+	}
+	for _, g := range groups {
+		if g.count == 1 {
+			fmt.Fprintf(&out, "  %dms: %s\n", g.from, g.result)
+		} else {
+			fmt.Fprintf(&out, "  %d–%dms: %s (%d times)\n", g.from, g.to, g.result, g.count)
+		}
+	}
+	return strings.TrimSuffix(out.String(), "\n")
+}
@@ -0,0 +1,90 @@
+package runner
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"os/exec"
+	"strings"
+	"time"
+
+	"github.com/chibuka/95/client"
+)
+
+// killGracePeriod is how long a process group gets to exit after SIGTERM
+// before the remaining processes are killed
+const killGracePeriod = 2 * time.Second
+
+// pipeDrainTimeout is how long to keep reading output after the program exits
+const pipeDrainTimeout = 500 * time.Millisecond
+
+// processGroup tears down every process started by a test, not just the
+// direct child. Under 'go run' or 'cargo run' the direct child is only the
+// toolchain wrapper, the real program is one of its children.
+type processGroup struct {
+	cmd    *exec.Cmd
+	reaped []client.ReapedProcess
+}
+
+// newProcessGroup makes cmd terminate its whole process group when its
+// context is done. The command must start in its own process group.
+func newProcessGroup(cmd *exec.Cmd) *processGroup {
+	g := &processGroup{cmd: cmd}
+
+	cmd.Cancel = func() error {
+		g.reaped = append(g.reaped, terminateProcessGroup(cmd.Process.Pid, killGracePeriod)...)
+		return nil
+	}
+	// Cancel only returns once the group is gone, and output written before the
+	// program exited drains quickly, so pipes still open after this are held by
+	// leftover children that wait() is about to kill
+	cmd.WaitDelay = pipeDrainTimeout
+
+	return g
+}
+
+// wait waits for the command and kills anything it left running in its group
+func (g *processGroup) wait() error {
+	err := g.cmd.Wait()
+	if pgid := g.cmd.Process.Pid; len(listProcessGroup(pgid)) > 0 {
+		g.reaped = append(g.reaped, terminateProcessGroup(pgid, killGracePeriod)...)
+	}
+
+	// the program exited fine, only a leftover child held the output open
+	if errors.Is(err, exec.ErrWaitDelay) {
+		return nil
+	}
+	return err
+}
+
+// recordOutcome fills in how the program ended. A non-zero exit, a signal or
+// the test timeout are all results worth reporting, any other error means the
+// program could not be run at all.
+func recordOutcome(ctx context.Context, cmd *exec.Cmd, waitErr error, result *client.TestResult) error {
+	result.TimedOut = errors.Is(ctx.Err(), context.DeadlineExceeded)
+	if state := cmd.ProcessState; state != nil {
+		result.ExitCode = state.ExitCode()
+		result.Signal = exitSignal(state)
+	}
+
+	if waitErr == nil || result.TimedOut {
+		return nil
+	}
+	if _, ok := waitErr.(*exec.ExitError); ok {
+		return nil
+	}
+	return fmt.Errorf("command execution failed: %w%s", waitErr, describeReaped(result.ReapedProcesses))
+}
+
+// describeReaped lists reaped processes for error messages
+func describeReaped(reaped []client.ReapedProcess) string {
+	if len(reaped) == 0 {
+		return ""
+	}
+
+	var procs []string
+	for _, p := range reaped {
+		procs = append(procs, fmt.Sprintf("%d %s", p.Pid, p.Command))
+	}
+	return fmt.Sprintf(" (killed: %s)", strings.Join(procs, ", "))
+}
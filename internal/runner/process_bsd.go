@@ -0,0 +1,43 @@
+//go:build !linux && !windows
+
+package runner
+
+import (
+	"os/exec"
+	"path/filepath"
+	"strconv"
+	"strings"
+
+	"github.com/chibuka/95/client"
+)
+
+// listProcessGroup returns the live (non-zombie) processes in a process group
+func listProcessGroup(pgid int) []client.ReapedProcess {
+	// no /proc here, ask ps instead
+	out, err := exec.Command("ps", "-A", "-o", "pid=,pgid=,stat=,comm=").Output()
+	if err != nil {
+		return nil
+	}
+
+	var members []client.ReapedProcess
+	for _, line := range strings.Split(string(out), "\n") {
+		fields := strings.Fields(line)
+		if len(fields) < 4 || strings.HasPrefix(fields[2], "Z") {
+			continue
+		}
+		if group, err := strconv.Atoi(fields[1]); err != nil || group != pgid {
+			continue
+		}
+		pid, err := strconv.Atoi(fields[0])
+		if err != nil {
+			continue
+		}
+
+		members = append(members, client.ReapedProcess{
+			Pid:     pid,
+			Command: filepath.Base(strings.Join(fields[3:], " ")),
+		})
+	}
+
+	return members
+}
@@ -0,0 +1,53 @@
+package runner
+
+import (
+	"os"
+	"strconv"
+	"strings"
+
+	"github.com/chibuka/95/client"
+)
+
+// listProcessGroup returns the live (non-zombie) processes in a process group
+func listProcessGroup(pgid int) []client.ReapedProcess {
+	entries, err := os.ReadDir("/proc")
+	if err != nil {
+		return nil
+	}
+
+	var members []client.ReapedProcess
+	for _, entry := range entries {
+		pid, err := strconv.Atoi(entry.Name())
+		if err != nil {
+			continue
+		}
+
+		stat, err := os.ReadFile("/proc/" + entry.Name() + "/stat")
+		if err != nil {
+			// the process exited while we were looking
+			continue
+		}
+
+		// format: pid (comm) state ppid pgrp ...
+		// comm may contain spaces and parentheses, so split on the last ')'
+		s := string(stat)
+		start, end := strings.IndexByte(s, '('), strings.LastIndexByte(s, ')')
+		if start < 0 || end < start {
+			continue
+		}
+		fields := strings.Fields(s[end+1:])
+		if len(fields) < 3 || fields[0] == "Z" {
+			continue
+		}
+		if group, err := strconv.Atoi(fields[2]); err != nil || group != pgid {
+			continue
+		}
+
+		members = append(members, client.ReapedProcess{
+			Pid:     pid,
+			Command: s[start+1 : end],
+		})
+	}
+
+	return members
+}
@@ -0,0 +1,44 @@
+//go:build !windows
+
+package runner
+
+import (
+	"os"
+	"syscall"
+	"time"
+
+	"github.com/chibuka/95/client"
+	"golang.org/x/sys/unix"
+)
+
+// terminateProcessGroup sends SIGTERM to every process in the group, then
+// SIGKILL to whatever is still running after the grace period. It returns
+// the processes that were running when the group was signalled.
+func terminateProcessGroup(pgid int, grace time.Duration) []client.ReapedProcess {
+	members := listProcessGroup(pgid)
+	if len(members) == 0 {
+		return nil
+	}
+
+	_ = syscall.Kill(-pgid, syscall.SIGTERM)
+
+	deadline := time.Now().Add(grace)
+	for time.Now().Before(deadline) {
+		if len(listProcessGroup(pgid)) == 0 {
+			return members
+		}
+		time.Sleep(20 * time.Millisecond)
+	}
+
+	_ = syscall.Kill(-pgid, syscall.SIGKILL)
+	return members
+}
+
+// exitSignal returns the name of the signal that killed the process, if any
+func exitSignal(state *os.ProcessState) string {
+	status, ok := state.Sys().(syscall.WaitStatus)
+	if !ok || !status.Signaled() {
+		return ""
+	}
+	return unix.SignalName(status.Signal())
+}
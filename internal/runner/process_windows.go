@@ -0,0 +1,30 @@
+//go:build windows
+
+package runner
+
+import (
+	"os"
+	"os/exec"
+	"strconv"
+	"time"
+
+	"github.com/chibuka/95/client"
+)
+
+// listProcessGroup is not supported on Windows, where leftover children
+// can only be found through the process tree while its root is running
+func listProcessGroup(pgid int) []client.ReapedProcess {
+	return nil
+}
+
+// terminateProcessGroup kills the process and all of its children. The
+// killed processes are not reported on Windows.
+func terminateProcessGroup(pid int, grace time.Duration) []client.ReapedProcess {
+	_ = exec.Command("taskkill", "/T", "/F", "/PID", strconv.Itoa(pid)).Run()
+	return nil
+}
+
+// exitSignal always returns "", Windows processes are not killed by signals
+func exitSignal(state *os.ProcessState) string {
+	return ""
+}
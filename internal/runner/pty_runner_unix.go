@@ -0,0 +1,115 @@
+//go:build !windows
+
+package runner
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+	"sync/atomic"
+	"time"
+
+	"github.com/chibuka/95/client"
+	"github.com/creack/pty"
+)
+
+const (
+	ptyRows = 24
+	ptyCols = 80
+
+	// how long to keep reading buffered terminal output after the program exits
+	ptyDrainTimeout = 500 * time.Millisecond
+)
+
+// RunPTYTest runs the program attached to a pseudo-terminal. Input is typed one
+// command at a time, waiting for the program to be ready in between, and the
+// output is whatever the terminal displayed (including echoed input).
+func RunPTYTest(ctx context.Context, command *Command, test client.Test, opts TestOptions) (*client.TestResult, error) {
+	ctx, cancel := context.WithTimeout(ctx, time.Duration(test.TimeoutSeconds)*time.Second)
+	defer cancel()
+
+	// the pty makes the program a session leader, so it gets its own process group
+	execCmd := command.command(ctx)
+	execCmd.Dir = opts.Dir
+	group := newProcessGroup(execCmd)
+	var term map[string]string
+	if opts.Hermetic || os.Getenv("TERM") == "" {
+		term = map[string]string{"TERM": "xterm"}
+	}
+	cleanupEnv, err := setupEnv(execCmd, command, opts, term, opts.Env)
+	if err != nil {
+		return nil, err
+	}
+	defer cleanupEnv()
+
+	// too much output stops the program, like a timeout
+	var outputExceeded atomic.Bool
+	var output outputRecorder
+	output.setLimit(outputLimit(opts.Limits), func() {
+		outputExceeded.Store(true)
+		cancel()
+	})
+
+	if err := prepareProcess(execCmd, opts.Limits, opts.NoNetwork); err != nil {
+		return nil, fmt.Errorf("failed to prepare process: %w", err)
+	}
+
+	start := time.Now()
+	ptmx, err := pty.StartWithSize(execCmd, &pty.Winsize{Rows: ptyRows, Cols: ptyCols})
+	if err != nil {
+		return nil, fmt.Errorf("failed to start command in pty: %w", err)
+	}
+	defer ptmx.Close()
+
+	readDone := make(chan struct{})
+	go func() {
+		defer close(readDone)
+		// ends with EIO once every handle to the terminal is closed
+		_, _ = io.Copy(&output, ptmx)
+	}()
+
+	exited := make(chan struct{})
+	var waitErr error
+	go func() {
+		waitErr = group.wait()
+		close(exited)
+	}()
+
+	// sending test input line by line, like a user typing at a prompt
+	session := newInteractiveSession(opts.Interactive, ptmx, &output, exited)
+	session.echo = true
+	transcript := session.run(ctx, test.Stdin)
+
+	// Ctrl-D on an empty line is end of input, like closing the stdin pipe
+	_, _ = ptmx.Write([]byte{4})
+
+	<-exited
+	duration := time.Since(start)
+
+	select {
+	case <-readDone:
+	case <-time.After(ptyDrainTimeout):
+	}
+
+	// stdout and stderr share the terminal, so everything lands in stdout
+	result := &client.TestResult{
+		Stdout:          strings.ReplaceAll(output.String(), "\r\n", "\n"),
+		Transcript:      transcript,
+		ReapedProcesses: group.reaped,
+		DurationMs:      duration.Milliseconds(),
+		DurationUs:      duration.Microseconds(),
+		Usage:           measureUsage(execCmd.ProcessState, duration),
+	}
+	if err := recordOutcome(ctx, execCmd, waitErr, result); err != nil {
+		return nil, err
+	}
+	// stderr is mixed into the terminal output
+	result.LimitExceeded = detectLimitExceeded(opts.Limits, execCmd, result, result.Stdout, outputExceeded.Load())
+	if opts.Hermetic {
+		result.Environment = recordedEnv(execCmd.Env, term, opts.Env)
+	}
+
+	return result, nil
+}
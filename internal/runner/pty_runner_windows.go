@@ -0,0 +1,15 @@
+//go:build windows
+
+package runner
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/chibuka/95/client"
+)
+
+// RunPTYTest is not available on Windows, which has no pseudo-terminals
+func RunPTYTest(ctx context.Context, command *Command, test client.Test, opts TestOptions) (*client.TestResult, error) {
+	return nil, fmt.Errorf("pty mode is not supported on Windows, use the default pipe mode")
+}
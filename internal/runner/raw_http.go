@@ -0,0 +1,489 @@
+package runner
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"maps"
+	"net"
+	"net/http"
+	"os"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/chibuka/95/client"
+)
+
+const (
+	// unframedIdle ends a response without Content-Length or chunked
+	// encoding when the server keeps the connection open and stays silent
+	unframedIdle = time.Second
+	// maxRawBody caps the body read from a raw response
+	maxRawBody = 64 << 20
+	// maxRawLine caps a status, header or chunk size line
+	maxRawLine = 64 << 10
+)
+
+// sendRawRequest writes a request byte for byte to a new connection and
+// parses the response strictly. Ways the response breaks the protocol are
+// reported with it, only a response that can't be read at all is an error.
+func (h *httpServerRunner) sendRawRequest(ctx context.Context, req client.HttpRequest) (*client.HttpResponse, error) {
+	ctx, cancel := context.WithTimeout(ctx, 30*time.Second)
+	defer cancel()
+
+	var dialer net.Dialer
+	conn, err := dialer.DialContext(ctx, "tcp", net.JoinHostPort("localhost", strconv.Itoa(h.port)))
+	if err != nil {
+		if ctx.Err() == context.Canceled {
+			return nil, ctx.Err()
+		}
+		if ctx.Err() == context.DeadlineExceeded {
+			return nil, ErrServerTimeout
+		}
+		return nil, fmt.Errorf("could not connect to server: %w", err)
+	}
+	defer conn.Close()
+
+	deadline, _ := ctx.Deadline()
+	_ = conn.SetDeadline(deadline)
+	// cancelling the run unblocks reads too
+	stop := context.AfterFunc(ctx, func() { _ = conn.SetDeadline(time.Now()) })
+	defer stop()
+
+	raw := rawRequestBytes(req, h.port)
+	start := time.Now()
+	if _, err := conn.Write(raw); err != nil {
+		return nil, fmt.Errorf("could not send request: %w", err)
+	}
+
+	parser := &rawParser{conn: conn, r: bufio.NewReader(conn), deadline: deadline}
+	resp, err := parser.readResponse(requestMethod(raw) == "HEAD")
+	if err != nil {
+		// a cancelled run also shows up as a passed read deadline
+		if ctx.Err() == context.Canceled {
+			return nil, ctx.Err()
+		}
+		if ctx.Err() == context.DeadlineExceeded || errors.Is(err, os.ErrDeadlineExceeded) {
+			return nil, ErrServerTimeout
+		}
+		return nil, err
+	}
+	resp.LatencyUs = time.Since(start).Microseconds()
+	return resp, nil
+}
+
+// rawRequestBytes is what the raw client sends: Raw as written, or a request
+// built from the other fields with its headers sorted by name. A built
+// request asks the server to close the connection after responding.
+func rawRequestBytes(req client.HttpRequest, port int) []byte {
+	if req.Raw != "" {
+		return []byte(strings.ReplaceAll(req.Raw, portPlaceholder, strconv.Itoa(port)))
+	}
+
+	has := func(name string) bool {
+		for key := range req.Headers {
+			if strings.EqualFold(key, name) {
+				return true
+			}
+		}
+		return false
+	}
+
+	var b bytes.Buffer
+	fmt.Fprintf(&b, "%s %s HTTP/1.1\r\n", req.Method, req.Path)
+	if !has("Host") {
+		fmt.Fprintf(&b, "Host: localhost:%d\r\n", port)
+	}
+	for _, name := range slices.Sorted(maps.Keys(req.Headers)) {
+		fmt.Fprintf(&b, "%s: %s\r\n", name, req.Headers[name])
+	}
+	if req.Body != "" && !has("Content-Length") {
+		fmt.Fprintf(&b, "Content-Length: %d\r\n", len(req.Body))
+	}
+	if !has("Connection") {
+		b.WriteString("Connection: close\r\n")
+	}
+	b.WriteString("\r\n")
+	b.WriteString(req.Body)
+	return b.Bytes()
+}
+
+// requestMethod is the method on the request line of raw request bytes
+func requestMethod(raw []byte) string {
+	line, _, _ := bytes.Cut(raw, []byte("\n"))
+	method, _, _ := bytes.Cut(line, []byte(" "))
+	return string(method)
+}
+
+// rawParser reads one HTTP/1.x response the way RFC 9112 writes it, noting
+// every deviation instead of smoothing it over
+type rawParser struct {
+	conn       net.Conn
+	r          *bufio.Reader
+	deadline   time.Time
+	violations []string
+}
+
+// violate records a protocol violation, each one once
+func (p *rawParser) violate(format string, args ...any) {
+	msg := fmt.Sprintf(format, args...)
+	if !slices.Contains(p.violations, msg) {
+		p.violations = append(p.violations, msg)
+	}
+}
+
+func (p *rawParser) readResponse(head bool) (*client.HttpResponse, error) {
+	// interim responses (e.g. 100 Continue) come before the final one,
+	// 101 Switching Protocols is final: nothing HTTP follows it
+	var interim []string
+	var resp *client.HttpResponse
+	for {
+		line, err := p.readLine("status line")
+		if err == io.EOF {
+			return nil, fmt.Errorf("server closed the connection without responding")
+		}
+		if err != nil {
+			return nil, err
+		}
+		if resp, err = p.parseStatusLine(line); err != nil {
+			return nil, err
+		}
+		if err := p.readHeaders(resp); err != nil {
+			return nil, err
+		}
+
+		if resp.StatusCode/100 != 1 || resp.StatusCode == http.StatusSwitchingProtocols {
+			break
+		}
+		interim = append(interim, line)
+	}
+	resp.Interim = interim
+
+	body, err := p.readBody(resp, head)
+	if err != nil {
+		return nil, err
+	}
+	resp.Body = string(body)
+
+	if n := p.r.Buffered(); n > 0 {
+		p.violate("%d unexpected bytes after the response", n)
+	}
+
+	resp.Headers = make(map[string]string)
+	for _, field := range resp.RawHeaders {
+		key := http.CanonicalHeaderKey(field.Name)
+		if _, ok := resp.Headers[key]; !ok {
+			resp.Headers[key] = field.Value
+		}
+	}
+	resp.Violations = p.violations
+	return resp, nil
+}
+
+// readLine reads a line that should end with CRLF. A bare LF still ends it,
+// but is a violation.
+func (p *rawParser) readLine(what string) (string, error) {
+	var line []byte
+	for {
+		chunk, err := p.r.ReadSlice('\n')
+		line = append(line, chunk...)
+		if len(line) > maxRawLine {
+			return "", fmt.Errorf("%s is longer than %d bytes", what, maxRawLine)
+		}
+		if err == bufio.ErrBufferFull {
+			continue
+		}
+		if err == io.EOF {
+			if len(line) == 0 {
+				return "", io.EOF
+			}
+			return "", fmt.Errorf("connection closed in the middle of the %s %q", what, line)
+		}
+		if err != nil {
+			return "", err
+		}
+		break
+	}
+
+	line = line[:len(line)-1]
+	if bytes.HasSuffix(line, []byte("\r")) {
+		line = line[:len(line)-1]
+	} else {
+		p.violate("%s ends with LF instead of CRLF", what)
+	}
+	if bytes.IndexByte(line, '\r') >= 0 {
+		p.violate("%s contains a bare CR", what)
+	}
+	return string(line), nil
+}
+
+// parseStatusLine reads "HTTP-version SP status-code SP [reason-phrase]"
+func (p *rawParser) parseStatusLine(line string) (*client.HttpResponse, error) {
+	proto, rest, ok := strings.Cut(line, " ")
+	if !ok || !validHTTPVersion(proto) {
+		return nil, fmt.Errorf("malformed status line %q", line)
+	}
+	if proto != "HTTP/1.1" && proto != "HTTP/1.0" {
+		p.violate("unsupported protocol version %s", proto)
+	}
+	if strings.HasPrefix(rest, " ") {
+		p.violate("more than one space after the protocol version")
+		rest = strings.TrimLeft(rest, " ")
+	}
+
+	code, reason, hasReason := strings.Cut(rest, " ")
+	status, err := strconv.Atoi(code)
+	if err != nil || len(code) != 3 {
+		return nil, fmt.Errorf("malformed status code %q in status line %q", code, line)
+	}
+	if !hasReason {
+		p.violate("no space after the status code, it is required even without a reason phrase")
+	}
+	if status < 100 {
+		p.violate("status code %d is out of range", status)
+	}
+
+	return &client.HttpResponse{StatusCode: status, Proto: proto, Reason: reason}, nil
+}
+
+// validHTTPVersion reports whether version looks like "HTTP/1.1"
+func validHTTPVersion(version string) bool {
+	return len(version) == 8 && strings.HasPrefix(version, "HTTP/") &&
+		isDigit(version[5]) && version[6] == '.' && isDigit(version[7])
+}
+
+func isDigit(c byte) bool {
+	return c >= '0' && c <= '9'
+}
+
+// readHeaders reads the header lines up to the empty line ending them
+func (p *rawParser) readHeaders(resp *client.HttpResponse) error {
+	for {
+		line, err := p.readLine("header line")
+		if err == io.EOF {
+			return fmt.Errorf("connection closed before the end of the headers")
+		}
+		if err != nil {
+			return err
+		}
+		if line == "" {
+			return nil
+		}
+
+		if line[0] == ' ' || line[0] == '\t' {
+			p.violate("obsolete line folding in header line %q", line)
+			if n := len(resp.RawHeaders); n > 0 {
+				resp.RawHeaders[n-1].Value += " " + strings.Trim(line, " \t")
+			}
+			continue
+		}
+
+		name, value, ok := strings.Cut(line, ":")
+		if !ok {
+			p.violate("header line without a colon: %q", line)
+			continue
+		}
+		if trimmed := strings.TrimRight(name, " \t"); trimmed != name {
+			p.violate("whitespace between header name %q and the colon", trimmed)
+			name = trimmed
+		}
+		if name == "" {
+			p.violate("header line with an empty name: %q", line)
+			continue
+		}
+		if !validToken(name) {
+			p.violate("invalid character in header name %q", name)
+		}
+		resp.RawHeaders = append(resp.RawHeaders, client.HeaderField{Name: name, Value: strings.Trim(value, " \t")})
+	}
+}
+
+// validToken reports whether name only has the characters of an RFC 9110
+// token
+func validToken(name string) bool {
+	for i := 0; i < len(name); i++ {
+		c := name[i]
+		if c <= ' ' || c >= 0x7f || strings.IndexByte(`"(),/:;<=>?@[\]{}`, c) >= 0 {
+			return false
+		}
+	}
+	return true
+}
+
+// headerValues returns the values of every header named name, in order
+func headerValues(resp *client.HttpResponse, name string) []string {
+	var values []string
+	for _, field := range resp.RawHeaders {
+		if strings.EqualFold(field.Name, name) {
+			values = append(values, field.Value)
+		}
+	}
+	return values
+}
+
+// readBody reads the body framed by the headers, see RFC 9112 section 6.3
+func (p *rawParser) readBody(resp *client.HttpResponse, head bool) ([]byte, error) {
+	lengths := headerValues(resp, "Content-Length")
+	encodings := headerValues(resp, "Transfer-Encoding")
+
+	status := resp.StatusCode
+	if head || status/100 == 1 || status == http.StatusNoContent || status == http.StatusNotModified {
+		if status == http.StatusNoContent && len(lengths) > 0 {
+			p.violate("Content-Length in a 204 response")
+		}
+		if status/100 == 1 || status == http.StatusNoContent {
+			if len(encodings) > 0 {
+				p.violate("Transfer-Encoding in a %d response", status)
+			}
+		}
+		return nil, nil
+	}
+
+	if len(encodings) > 0 {
+		if len(lengths) > 0 {
+			p.violate("both Transfer-Encoding and Content-Length are set")
+		}
+		codings := strings.Split(strings.Join(encodings, ","), ",")
+		if last := strings.ToLower(strings.TrimSpace(codings[len(codings)-1])); last != "chunked" {
+			p.violate("unsupported Transfer-Encoding %q, the body is read until the connection closes", strings.Join(encodings, ", "))
+			return p.readUntilClose()
+		}
+		return p.readChunked()
+	}
+
+	if len(lengths) == 0 {
+		p.violate("no Content-Length or Transfer-Encoding, the body ends when the connection closes")
+		return p.readUntilClose()
+	}
+	if slices.ContainsFunc(lengths, func(v string) bool { return v != lengths[0] }) {
+		p.violate("conflicting Content-Length headers: %s", strings.Join(lengths, ", "))
+	} else if len(lengths) > 1 {
+		p.violate("Content-Length sent %d times", len(lengths))
+	}
+
+	length, err := strconv.ParseInt(lengths[0], 10, 64)
+	if err != nil || length < 0 || strings.HasPrefix(lengths[0], "+") {
+		p.violate("invalid Content-Length %q, the body is read until the connection closes", lengths[0])
+		return p.readUntilClose()
+	}
+	if length > maxRawBody {
+		return nil, fmt.Errorf("body of %d bytes is over the %d MB limit", length, maxRawBody>>20)
+	}
+
+	body := make([]byte, length)
+	n, err := io.ReadFull(p.r, body)
+	if errors.Is(err, io.EOF) || errors.Is(err, io.ErrUnexpectedEOF) {
+		p.violate("body is %d bytes, Content-Length says %d", n, length)
+		return body[:n], nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	return body, nil
+}
+
+// readChunked reads a chunked body and its trailer section
+func (p *rawParser) readChunked() ([]byte, error) {
+	var body []byte
+	for {
+		line, err := p.readLine("chunk size line")
+		if err == io.EOF {
+			p.violate("connection closed before the last chunk")
+			return body, nil
+		}
+		if err != nil {
+			return nil, err
+		}
+
+		sizeText, _, _ := strings.Cut(line, ";")
+		if trimmed := strings.TrimSpace(sizeText); trimmed != sizeText {
+			p.violate("whitespace around chunk size %q", trimmed)
+			sizeText = trimmed
+		}
+		size, err := strconv.ParseInt(sizeText, 16, 64)
+		if err != nil || size < 0 {
+			return nil, fmt.Errorf("invalid chunk size line %q", line)
+		}
+		if int64(len(body))+size > maxRawBody {
+			return nil, fmt.Errorf("chunked body is over the %d MB limit", maxRawBody>>20)
+		}
+
+		if size == 0 {
+			// trailer fields, up to the empty line
+			for {
+				line, err := p.readLine("trailer line")
+				if err == io.EOF {
+					p.violate("connection closed before the end of the chunked body")
+					return body, nil
+				}
+				if err != nil {
+					return nil, err
+				}
+				if line == "" {
+					return body, nil
+				}
+			}
+		}
+
+		chunk := make([]byte, size)
+		n, err := io.ReadFull(p.r, chunk)
+		body = append(body, chunk[:n]...)
+		if errors.Is(err, io.EOF) || errors.Is(err, io.ErrUnexpectedEOF) {
+			p.violate("chunk is %d bytes, its size line says %d", n, size)
+			return body, nil
+		}
+		if err != nil {
+			return nil, err
+		}
+
+		end, err := p.readLine("chunk")
+		if err == io.EOF {
+			p.violate("connection closed before the last chunk")
+			return body, nil
+		}
+		if err != nil {
+			return nil, err
+		}
+		if end != "" {
+			p.violate("chunk data is longer than its size of %d", size)
+		}
+	}
+}
+
+// readUntilClose reads a body that ends when the server closes the
+// connection, or goes silent for unframedIdle
+func (p *rawParser) readUntilClose() ([]byte, error) {
+	var body []byte
+	buf := make([]byte, 32<<10)
+	for {
+		_ = p.conn.SetReadDeadline(earliest(time.Now().Add(unframedIdle), p.deadline))
+		n, err := p.r.Read(buf)
+		body = append(body, buf[:n]...)
+		if len(body) > maxRawBody {
+			return nil, fmt.Errorf("body is over the %d MB limit", maxRawBody>>20)
+		}
+		if err == io.EOF {
+			return body, nil
+		}
+		if errors.Is(err, os.ErrDeadlineExceeded) && time.Now().Before(p.deadline) {
+			p.violate("the server kept the connection open after a body without framing")
+			return body, nil
+		}
+		if err != nil {
+			return nil, err
+		}
+	}
+}
+
+// earliest returns the earlier of two times, a zero time counts as never
+func earliest(a, b time.Time) time.Time {
+	if b.IsZero() || a.Before(b) {
+		return a
+	}
+	return b
+}
@@ -0,0 +1,252 @@
+package runner
+
+import (
+	"bufio"
+	"net"
+	"slices"
+	"strings"
+	"testing"
+	"time"
+)
+
+// rawParserFor returns a parser reading a response that the server side of a
+// pipe writes before closing the connection
+func rawParserFor(t *testing.T, response string) *rawParser {
+	t.Helper()
+	serverConn, clientConn := net.Pipe()
+	t.Cleanup(func() { clientConn.Close() })
+	go func() {
+		_, _ = serverConn.Write([]byte(response))
+		serverConn.Close()
+	}()
+
+	deadline := time.Now().Add(5 * time.Second)
+	_ = clientConn.SetDeadline(deadline)
+	return &rawParser{conn: clientConn, r: bufio.NewReader(clientConn), deadline: deadline}
+}
+
+func TestRawParserReadResponse(t *testing.T) {
+	tests := []struct {
+		name       string
+		response   string
+		head       bool
+		status     int
+		reason     string
+		body       string
+		interim    []string
+		violations []string
+		err        string
+	}{
+		{
+			name:     "content length",
+			response: "HTTP/1.1 200 OK\r\nContent-Length: 5\r\n\r\nhello",
+			status:   200,
+			reason:   "OK",
+			body:     "hello",
+		},
+		{
+			name:     "head response has no body",
+			response: "HTTP/1.1 200 OK\r\nContent-Length: 5\r\n\r\n",
+			head:     true,
+			status:   200,
+			reason:   "OK",
+		},
+
+		// interim responses
+		{
+			name:     "100 continue before the response",
+			response: "HTTP/1.1 100 Continue\r\n\r\nHTTP/1.1 200 OK\r\nContent-Length: 2\r\n\r\nok",
+			status:   200,
+			reason:   "OK",
+			body:     "ok",
+			interim:  []string{"HTTP/1.1 100 Continue"},
+		},
+		{
+			name: "several interim responses",
+			response: "HTTP/1.1 100 Continue\r\n\r\n" +
+				"HTTP/1.1 103 Early Hints\r\nLink: </style.css>; rel=preload\r\n\r\n" +
+				"HTTP/1.1 204 No Content\r\n\r\n",
+			status:  204,
+			reason:  "No Content",
+			interim: []string{"HTTP/1.1 100 Continue", "HTTP/1.1 103 Early Hints"},
+		},
+		{
+			name:     "101 switching protocols is final",
+			response: "HTTP/1.1 101 Switching Protocols\r\nUpgrade: websocket\r\n\r\n",
+			status:   101,
+			reason:   "Switching Protocols",
+		},
+		{
+			name:     "interim response only",
+			response: "HTTP/1.1 100 Continue\r\n\r\n",
+			err:      "server closed the connection without responding",
+		},
+
+		// chunked bodies
+		{
+			name:     "chunked",
+			response: "HTTP/1.1 200 OK\r\nTransfer-Encoding: chunked\r\n\r\n5\r\nhello\r\n6\r\n world\r\n0\r\n\r\n",
+			status:   200,
+			reason:   "OK",
+			body:     "hello world",
+		},
+		{
+			name:     "chunked with extensions and trailers",
+			response: "HTTP/1.1 200 OK\r\nTransfer-Encoding: chunked\r\n\r\na;name=value\r\n0123456789\r\n0\r\nChecksum: abc\r\n\r\n",
+			status:   200,
+			reason:   "OK",
+			body:     "0123456789",
+		},
+		{
+			name:       "chunked and content length",
+			response:   "HTTP/1.1 200 OK\r\nTransfer-Encoding: chunked\r\nContent-Length: 3\r\n\r\n2\r\nok\r\n0\r\n\r\n",
+			status:     200,
+			reason:     "OK",
+			body:       "ok",
+			violations: []string{"both Transfer-Encoding and Content-Length are set"},
+		},
+		{
+			name:       "chunk longer than its size",
+			response:   "HTTP/1.1 200 OK\r\nTransfer-Encoding: chunked\r\n\r\n2\r\nokay\r\n0\r\n\r\n",
+			status:     200,
+			reason:     "OK",
+			body:       "ok",
+			violations: []string{"chunk data is longer than its size of 2"},
+		},
+		{
+			name:       "closed before the last chunk",
+			response:   "HTTP/1.1 200 OK\r\nTransfer-Encoding: chunked\r\n\r\n2\r\nok\r\n",
+			status:     200,
+			reason:     "OK",
+			body:       "ok",
+			violations: []string{"connection closed before the last chunk"},
+		},
+		{
+			name:     "invalid chunk size",
+			response: "HTTP/1.1 200 OK\r\nTransfer-Encoding: chunked\r\n\r\nzz\r\nok\r\n0\r\n\r\n",
+			err:      `invalid chunk size line "zz"`,
+		},
+
+		// bodies that end when the connection closes
+		{
+			name:       "close delimited",
+			response:   "HTTP/1.1 200 OK\r\n\r\nuntil the end",
+			status:     200,
+			reason:     "OK",
+			body:       "until the end",
+			violations: []string{"no Content-Length or Transfer-Encoding, the body ends when the connection closes"},
+		},
+		{
+			name:     "unsupported transfer encoding",
+			response: "HTTP/1.1 200 OK\r\nTransfer-Encoding: gzip\r\n\r\nraw",
+			status:   200,
+			reason:   "OK",
+			body:     "raw",
+			violations: []string{
+				`unsupported Transfer-Encoding "gzip", the body is read until the connection closes`,
+			},
+		},
+		{
+			name:       "short body",
+			response:   "HTTP/1.1 200 OK\r\nContent-Length: 10\r\n\r\nshort",
+			status:     200,
+			reason:     "OK",
+			body:       "short",
+			violations: []string{"body is 5 bytes, Content-Length says 10"},
+		},
+
+		// status lines
+		{
+			name:     "empty response",
+			response: "",
+			err:      "server closed the connection without responding",
+		},
+		{
+			name:     "not http",
+			response: "HTP/1.1 200 OK\r\n\r\n",
+			err:      `malformed status line "HTP/1.1 200 OK"`,
+		},
+		{
+			name:     "no status code",
+			response: "HTTP/1.1\r\n\r\n",
+			err:      `malformed status line "HTTP/1.1"`,
+		},
+		{
+			name:     "two digit status code",
+			response: "HTTP/1.1 20 OK\r\n\r\n",
+			err:      `malformed status code "20"`,
+		},
+		{
+			name:     "status code that isn't a number",
+			response: "HTTP/1.1 2x0 OK\r\n\r\n",
+			err:      `malformed status code "2x0"`,
+		},
+		{
+			name:     "cut in the status line",
+			response: "HTTP/1.1 200",
+			err:      "connection closed in the middle of the status line",
+		},
+		{
+			name:       "no reason phrase or space",
+			response:   "HTTP/1.1 204\r\n\r\n",
+			status:     204,
+			violations: []string{"no space after the status code, it is required even without a reason phrase"},
+		},
+		{
+			name:     "empty reason phrase",
+			response: "HTTP/1.1 204 \r\n\r\n",
+			status:   204,
+		},
+		{
+			name:       "unsupported version",
+			response:   "HTTP/2.0 204 No Content\r\n\r\n",
+			status:     204,
+			reason:     "No Content",
+			violations: []string{"unsupported protocol version HTTP/2.0"},
+		},
+		{
+			name:       "bare LF",
+			response:   "HTTP/1.1 200 OK\nContent-Length: 2\r\n\r\nok",
+			status:     200,
+			reason:     "OK",
+			body:       "ok",
+			violations: []string{"status line ends with LF instead of CRLF"},
+		},
+		{
+			name:       "extra spaces",
+			response:   "HTTP/1.1  200 OK\r\nContent-Length: 2\r\n\r\nok",
+			status:     200,
+			reason:     "OK",
+			body:       "ok",
+			violations: []string{"more than one space after the protocol version"},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			resp, err := rawParserFor(t, tt.response).readResponse(tt.head)
+			if tt.err != "" {
+				if err == nil || !strings.Contains(err.Error(), tt.err) {
+					t.Fatalf("error = %v, want one containing %q", err, tt.err)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+
+			if resp.StatusCode != tt.status || resp.Reason != tt.reason {
+				t.Errorf("status = %d %q, want %d %q", resp.StatusCode, resp.Reason, tt.status, tt.reason)
+			}
+			if resp.Body != tt.body {
+				t.Errorf("body = %q, want %q", resp.Body, tt.body)
+			}
+			if !slices.Equal(resp.Interim, tt.interim) {
+				t.Errorf("interim = %q, want %q", resp.Interim, tt.interim)
+			}
+			if !slices.Equal(resp.Violations, tt.violations) {
+				t.Errorf("violations = %q, want %q", resp.Violations, tt.violations)
+			}
+		})
+	}
+}
@@ -18,10 +18,14 @@ var (
 	ErrConnectionFailed     = errors.New("connection failed")
 )
 
-func (h *httpServerRunner) sendRequest(req client.HttpRequest) (*client.HttpResponse, error) {
+func (h *httpServerRunner) sendRequest(ctx context.Context, req client.HttpRequest) (*client.HttpResponse, error) {
+	if req.Raw != "" || h.config.Client == client.ClientRaw {
+		return h.sendRawRequest(ctx, req)
+	}
+
 	url := fmt.Sprintf("http://localhost:%d%s", h.port, req.Path)
 
-	ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
+	ctx, cancel := context.WithTimeout(ctx, 30*time.Second)
 	defer cancel()
 
 	var bodyReader io.Reader
@@ -43,6 +47,7 @@ func (h *httpServerRunner) sendRequest(req client.HttpRequest) (*client.HttpResp
 			DisableCompression: true,
 		},
 	}
+	start := time.Now()
 	resp, err := httpClient.Do(httpReq)
 
 	if err != nil {
@@ -67,6 +72,7 @@ func (h *httpServerRunner) sendRequest(req client.HttpRequest) (*client.HttpResp
 		}
 		return nil, fmt.Errorf("could not read server response: %w", err)
 	}
+	latency := time.Since(start)
 
 	headers := make(map[string]string)
 	for k, v := range resp.Header {
@@ -79,5 +85,6 @@ func (h *httpServerRunner) sendRequest(req client.HttpRequest) (*client.HttpResp
 		StatusCode: resp.StatusCode,
 		Body:       string(body),
 		Headers:    headers,
+		LatencyUs:  latency.Microseconds(),
 	}, nil
 }
@@ -1,114 +1,273 @@
 package runner
 
 import (
-	"bytes"
 	"context"
 	"fmt"
-	"net/http"
-	"os"
+	"io"
 	"os/exec"
+	"strconv"
 	"strings"
 	"time"
+	"unicode/utf8"
 
 	"github.com/chibuka/95/client"
 )
 
+// crashWait is how long a failed request waits for the server to exit
+const crashWait = 500 * time.Millisecond
+
+// maxExitOutputLines is how much of its output is shown when a server exits
+const maxExitOutputLines = 20
+
+// maxServerOutputBytes is how much of each output stream of the server a
+// result carries, the end of it
+const maxServerOutputBytes = 64 << 10
+
 type httpServerRunner struct {
 	cmd    *exec.Cmd
 	port   int
 	config *client.ServerConfig
+
+	probe *readinessProbe
+	// every check of the probe while the server started
+	probes []client.ProbeAttempt
+
+	stdout outputRecorder
+	stderr outputRecorder
+
+	// closed once the server process exited, the only goroutine waiting
+	// on it is started with it
+	exited  chan struct{}
+	stopped bool
+
+	sampler *usageSampler
+	// what the server used, set once it is stopped
+	usage *client.ResourceUsage
+	// removes the temporary home of hermetic mode
+	cleanupEnv func()
+	// the environment recorded in results, only in hermetic mode
+	env []string
 }
 
-func (h *httpServerRunner) startServer(programConfig *client.ProgramConfig, runCommand string) error {
-	// Parse the run command
-	splitCmd := strings.Fields(runCommand)
-	if len(splitCmd) == 0 {
-		return fmt.Errorf("run command is empty")
+func (h *httpServerRunner) startServer(ctx context.Context, programConfig *client.ProgramConfig, command *Command, opts TestOptions) error {
+	probe, err := newReadinessProbe(h.config.Readiness)
+	if err != nil {
+		return err
 	}
+	h.probe = probe
 
-	// Build command with program config args
-	args := splitCmd[1:]
-	args = append(args, programConfig.Args...)
+	// Pick the port before anything starts, a port in use would have the
+	// tests talk to another process
+	var portEnv map[string]string
+	if h.config.DynamicPort {
+		port, err := freePort()
+		if err != nil {
+			return err
+		}
+		h.port = port
+		portEnv = map[string]string{"PORT": strconv.Itoa(port)}
+	} else {
+		if err := checkPortFree(h.config.Port); err != nil {
+			return err
+		}
+		h.port = h.config.Port
+	}
 
-	h.cmd = exec.Command(splitCmd[0], args...)
+	// Build command with program config args
+	h.cmd = command.command(context.Background(), withPort(programConfig.Args, h.port)...)
+	h.cmd.Dir = opts.Dir
 
-	// Set environment variables
-	env := os.Environ()
-	for k, v := range programConfig.Env {
-		env = append(env, fmt.Sprintf("%s=%s", k, v))
+	// Set environment variables, the test's own override the stage's, the
+	// port is set last
+	cleanupEnv, err := setupEnv(h.cmd, command, opts, programConfig.Env, opts.Env, portEnv)
+	if err != nil {
+		return err
+	}
+	h.cleanupEnv = cleanupEnv
+	if opts.Hermetic {
+		h.env = recordedEnv(h.cmd.Env, programConfig.Env, opts.Env, portEnv)
 	}
-	h.cmd.Env = env
 	h.cmd.SysProcAttr = sysProcAttr()
 
-	// Capture output for debugging
-	var stdout, stderr bytes.Buffer
-	h.cmd.Stdout = &stdout
-	h.cmd.Stderr = &stderr
+	// Capture output for the results and startup errors, a server that
+	// keeps printing is not stopped, its output is only cut
+	h.stdout.setLimit(outputLimit(opts.Limits), nil)
+	h.stderr.setLimit(outputLimit(opts.Limits), nil)
+	h.cmd.Stdout = &h.stdout
+	h.cmd.Stderr = &h.stderr
+	if probe.kind == client.ProbeLog {
+		h.cmd.Stdout = io.MultiWriter(&h.stdout, probe.watch())
+		h.cmd.Stderr = io.MultiWriter(&h.stderr, probe.watch())
+	}
+	// Reap the server without waiting on pipes held by escaped children
+	h.cmd.WaitDelay = time.Second
 
+	if err := prepareProcess(h.cmd, opts.Limits, false); err != nil {
+		h.cleanupEnv()
+		return fmt.Errorf("failed to prepare process: %w", err)
+	}
 	if err := h.cmd.Start(); err != nil {
+		h.cleanupEnv()
 		return fmt.Errorf("failed to start server: %w", err)
 	}
+	h.sampler = startUsageSampler(h.cmd.Process.Pid)
 
-	// Check if process is still running
-	if h.cmd.Process == nil {
-		return fmt.Errorf("server process exited immediately")
-	}
-
-	h.port = h.config.Port
+	h.exited = make(chan struct{})
+	go func() {
+		_ = h.cmd.Wait()
+		close(h.exited)
+	}()
 
 	// Wait for server to be ready
-	return h.waitForServer()
+	return h.waitForServer(ctx)
 }
 
-func (h *httpServerRunner) waitForServer() error {
-	deadline := time.Now().Add(time.Duration(h.config.StartupWaitMs) * time.Millisecond)
-	url := fmt.Sprintf("http://localhost:%d", h.port)
+// waitForServer runs the readiness probe until it passes or the startup wait
+// is over. The wait between attempts grows by the backoff of the probe.
+func (h *httpServerRunner) waitForServer(ctx context.Context) error {
+	start := time.Now()
+	deadline := start.Add(time.Duration(h.config.StartupWaitMs) * time.Millisecond)
 
-	attempt := 1
-	for time.Now().Before(deadline) {
+	interval := h.probe.interval
+	for {
+		if err := ctx.Err(); err != nil {
+			return err
+		}
+		// no use waiting for a server that is gone, e.g. it didn't compile
+		if h.hasExited() {
+			return fmt.Errorf("%s before it was ready%s", h.describeExit(), h.outputTail(""))
+		}
 
-		ctx, cancel := context.WithTimeout(context.Background(), 500*time.Millisecond)
-		req, err := http.NewRequestWithContext(ctx, "GET", url, nil)
-		if err != nil {
-			cancel()
-			return fmt.Errorf("failed to create health check request: %w", err)
+		ready, result := h.probe.check(ctx, h.port)
+		h.probes = append(h.probes, client.ProbeAttempt{
+			ElapsedMs: time.Since(start).Milliseconds(),
+			Ready:     ready,
+			Result:    result,
+		})
+		if ready {
+			return nil
+		}
+		if !time.Now().Before(deadline) {
+			break
+		}
+
+		// a log probe is ready as soon as the line is printed
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-time.After(min(interval, time.Until(deadline))):
+		case <-h.probe.matched:
+		case <-h.exited:
 		}
+		interval = min(time.Duration(float64(interval)*h.probe.backoff), h.probe.maxInterval)
+	}
 
-		resp, err := http.DefaultClient.Do(req)
-		cancel()
+	return fmt.Errorf("server was not ready within %dms, waiting for %s:\n%s",
+		h.config.StartupWaitMs, h.probe, describeAttempts(h.probes))
+}
 
-		if err == nil {
-			resp.Body.Close()
-			return nil
+// outputMark is a position in the output of the server
+type outputMark struct {
+	stdout int
+	stderr int
+}
+
+// mark returns the current end of the output
+func (h *httpServerRunner) mark() outputMark {
+	return outputMark{stdout: h.stdout.Len(), stderr: h.stderr.Len()}
+}
+
+// outputSince returns what the server printed from a mark on, the last
+// maxServerOutputBytes of each stream. Results carry it, so a chatty server
+// doesn't repeat megabytes of logs in every one of them.
+func (h *httpServerRunner) outputSince(from outputMark) *client.ServerOutput {
+	to := h.mark()
+	output := &client.ServerOutput{}
+	output.Stdout, output.Truncated = outputTailSince(&h.stdout, from.stdout, to.stdout)
+	stderr, truncated := outputTailSince(&h.stderr, from.stderr, to.stderr)
+	output.Stderr, output.Truncated = stderr, output.Truncated || truncated
+	return output
+}
+
+// outputTailSince returns the end of the output between two offsets, at most
+// maxServerOutputBytes of it starting on a whole character, and whether the
+// rest was cut
+func outputTailSince(recorder *outputRecorder, from, to int) (string, bool) {
+	if to-from <= maxServerOutputBytes {
+		return recorder.slice(from, to), false
+	}
+	text := recorder.slice(to-maxServerOutputBytes, to)
+	for len(text) > 0 && !utf8.RuneStart(text[0]) {
+		text = text[1:]
+	}
+	return text, true
+}
+
+// describeExit tells how the server exited, once it did
+func (h *httpServerRunner) describeExit() string {
+	state := h.cmd.ProcessState
+	if signal := exitSignal(state); signal != "" {
+		return "server was killed by " + signal
+	}
+	return fmt.Sprintf("server exited with code %d", state.ExitCode())
+}
+
+// outputTail returns the last lines the server printed on each stream, to
+// follow the description of its exit, indented by indent
+func (h *httpServerRunner) outputTail(indent string) string {
+	var out strings.Builder
+	for _, stream := range []struct {
+		name     string
+		recorder *outputRecorder
+	}{{"stderr", &h.stderr}, {"stdout", &h.stdout}} {
+		text := strings.TrimRight(stream.recorder.String(), "\n")
+		if text == "" {
+			continue
 		}
+		lines := strings.Split(text, "\n")
+		if len(lines) > maxExitOutputLines {
+			lines = append([]string{"…"}, lines[len(lines)-maxExitOutputLines:]...)
+		}
+		fmt.Fprintf(&out, "\n\n%s%s:\n%s  %s", indent, stream.name, indent, strings.Join(lines, "\n"+indent+"  "))
+	}
+	return out.String()
+}
 
-		time.Sleep(200 * time.Millisecond)
-		attempt++
+// requestError explains a failed request when the server crashed. The
+// connection drops before the exit is seen, so it waits a moment for it.
+func (h *httpServerRunner) requestError(err error) error {
+	select {
+	case <-h.exited:
+		return fmt.Errorf("%w\n\n  → The %s%s", err, h.describeExit(), h.outputTail("    "))
+	case <-time.After(crashWait):
+		return err
 	}
+}
 
-	return fmt.Errorf("server did not start within %dms", h.config.StartupWaitMs)
+// hasExited reports whether the server process is gone, e.g. it crashed
+func (h *httpServerRunner) hasExited() bool {
+	select {
+	case <-h.exited:
+		return true
+	default:
+		return false
+	}
 }
 
 func (h *httpServerRunner) stopServer() {
-	if h.cmd == nil || h.cmd.Process == nil {
+	// not started, or already stopped
+	if h.exited == nil || h.stopped {
 		return
 	}
+	h.stopped = true
 
-	// Try graceful shutdown
-	h.cmd.Process.Signal(os.Interrupt)
-
-	// Wait a bit, then force kill if still running
-	done := make(chan error)
-	go func() {
-		_, err := h.cmd.Process.Wait()
-		done <- err
-	}()
+	// Try graceful shutdown of the whole group, force kill after the grace
+	// period. Children may outlive a server that exited on its own.
+	terminateProcessGroup(h.cmd.Process.Pid, killGracePeriod)
+	<-h.exited
 
-	select {
-	case <-done:
-		// Process exited
-	case <-time.After(2 * time.Second):
-		// Force kill
-		killProcess(h.cmd.Process.Pid)
+	if h.sampler != nil {
+		h.usage = h.sampler.finish(h.cmd.ProcessState)
 	}
+	h.cleanupEnv()
 }
@@ -9,7 +9,3 @@ func sysProcAttr() *syscall.SysProcAttr {
 		Setpgid: true,
 	}
 }
-
-func killProcess(pid int) error {
-	return syscall.Kill(-pid, syscall.SIGTERM)
-}
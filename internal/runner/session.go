@@ -0,0 +1,109 @@
+package runner
+
+import (
+	"context"
+	"io"
+	"strings"
+	"time"
+
+	"github.com/chibuka/95/client"
+)
+
+const (
+	// silence that counts as ready when the stage has no prompt configured
+	defaultQuietPeriod = 100 * time.Millisecond
+
+	// when a prompt is configured but never shows up (e.g. it is buffered),
+	// give up waiting for it after this much silence
+	promptFallbackPeriod = 2 * time.Second
+)
+
+// interactiveSession feeds stdin to a running program one command at a time,
+// waiting until the program is ready before typing the next one
+type interactiveSession struct {
+	input  io.Writer
+	output *outputRecorder
+	exited <-chan struct{}
+	prompt string
+	quiet  time.Duration
+	// the terminal echoes typed commands back into the output
+	echo bool
+}
+
+func newInteractiveSession(cfg client.InteractiveConfig, input io.Writer, output *outputRecorder, exited <-chan struct{}) *interactiveSession {
+	quiet := defaultQuietPeriod
+	if cfg.QuietMs > 0 {
+		quiet = time.Duration(cfg.QuietMs) * time.Millisecond
+	}
+	if cfg.Prompt != "" && quiet < promptFallbackPeriod {
+		quiet = promptFallbackPeriod
+	}
+
+	return &interactiveSession{
+		input:  input,
+		output: output,
+		exited: exited,
+		prompt: cfg.Prompt,
+		quiet:  quiet,
+	}
+}
+
+// run types every line of stdin and returns what the program printed in
+// response to each of them
+func (s *interactiveSession) run(ctx context.Context, stdin string) []client.TranscriptEntry {
+	// wait for the first prompt before typing anything
+	offset := s.output.waitReady(ctx, 0, s.prompt, s.quiet, s.exited)
+
+	var transcript []client.TranscriptEntry
+	for _, line := range inputLines(stdin) {
+		if ctx.Err() != nil || s.hasExited() {
+			break
+		}
+
+		start := time.Now()
+		if _, err := io.WriteString(s.input, line+"\n"); err != nil {
+			// the program stopped reading, nothing more to type
+			break
+		}
+
+		end := s.output.waitReady(ctx, offset, s.prompt, s.quiet, s.exited)
+		transcript = append(transcript, client.TranscriptEntry{
+			Command:   line,
+			Output:    s.commandOutput(line, offset, end),
+			ElapsedMs: time.Since(start).Milliseconds(),
+		})
+		offset = end
+	}
+
+	return transcript
+}
+
+// commandOutput extracts a command's output, without the echoed command
+// or the prompt that follows it
+func (s *interactiveSession) commandOutput(command string, from, to int) string {
+	output := strings.ReplaceAll(s.output.slice(from, to), "\r\n", "\n")
+	if s.echo {
+		output = strings.TrimPrefix(output, command+"\n")
+	}
+	if s.prompt != "" {
+		output = strings.TrimSuffix(output, s.prompt)
+	}
+	return output
+}
+
+func (s *interactiveSession) hasExited() bool {
+	select {
+	case <-s.exited:
+		return true
+	default:
+		return false
+	}
+}
+
+// inputLines splits test stdin into the lines a user would type
+func inputLines(stdin string) []string {
+	if stdin == "" {
+		return nil
+	}
+	return strings.Split(strings.TrimSuffix(stdin, "\n"), "\n")
+}
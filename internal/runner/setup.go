@@ -1,56 +1,178 @@
 package runner
 
 import (
+	"encoding/base64"
 	"errors"
 	"fmt"
 	"os"
 	"path/filepath"
+	"strconv"
+	"time"
 
 	"github.com/chibuka/95/client"
 )
 
-// ExecuteSetup performs setup operations before running a test
-func ExecuteSetup(setup *client.TestSetup) error {
+// ExecuteSetup performs setup operations before running a test: deletions
+// (files, then directories) come first, then creations. Paths are relative
+// to the workspace and may not leave it, see PathViolationError.
+func ExecuteSetup(setup *client.TestSetup, ws *Workspace) error {
 	if setup == nil {
 		return nil
 	}
 
 	// Delete files first (ensure clean slate from previous runs)
 	for _, file := range setup.DeleteFiles {
-		if err := os.Remove(file); err != nil && !os.IsNotExist(err) {
+		path, err := ws.resolveForDelete("delete file", file)
+		if err != nil {
+			return err
+		}
+		if err := os.Remove(path); err != nil && !os.IsNotExist(err) {
 			return fmt.Errorf("failed to delete file %s: %w", file, err)
 		}
 	}
 
+	for _, d := range setup.DeleteDirs {
+		path, err := ws.resolveForDelete("delete directory", d)
+		if err != nil {
+			return err
+		}
+		if err := os.RemoveAll(path); err != nil {
+			return fmt.Errorf("failed to delete directory %s: %w", d, err)
+		}
+	}
+
 	// Create directories
-	for _, dir := range setup.CreateDirs {
-		if err := os.MkdirAll(dir, 0755); err != nil {
-			return fmt.Errorf("failed to create directory %s: %w", dir, err)
+	for _, d := range setup.CreateDirs {
+		path, err := ws.resolve("create directory", d)
+		if err != nil {
+			return err
+		}
+		if err := os.MkdirAll(path, 0755); err != nil {
+			return fmt.Errorf("failed to create directory %s: %w", d, err)
 		}
 	}
 
 	// Create files with content
 	for _, file := range setup.CreateFiles {
-		path := file.Path
-		content := file.Content
+		path, err := ws.resolve("create file", file.Path)
+		if err != nil {
+			return err
+		}
+		content, err := fileContent(file)
+		if err != nil {
+			return err
+		}
 
 		// Ensure parent directory exists
-		dir := filepath.Dir(path)
-		if err := os.MkdirAll(dir, 0755); err != nil {
-			return fmt.Errorf("failed to create parent directory for %s: %w", path, err)
+		if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+			return fmt.Errorf("failed to create parent directory for %s: %w", file.Path, err)
+		}
+
+		// Replace symlinks instead of writing through them, in a linked
+		// sandbox they point at the real project files
+		if info, err := os.Lstat(path); err == nil && info.Mode()&os.ModeSymlink != 0 {
+			if err := os.Remove(path); err != nil {
+				return fmt.Errorf("failed to replace symlink %s: %w", file.Path, err)
+			}
 		}
 
 		// Write file
-		if err := os.WriteFile(path, []byte(content), 0644); err != nil {
-			return fmt.Errorf("failed to create file %s: %w", path, err)
+		if err := os.WriteFile(path, content, 0644); err != nil {
+			return fmt.Errorf("failed to create file %s: %w", file.Path, err)
+		}
+
+		if err := applyFileAttributes(path, file); err != nil {
+			return err
+		}
+	}
+
+	// Create symlinks
+	for _, link := range setup.Symlinks {
+		path, err := ws.resolve("create symlink", link.Path)
+		if err != nil {
+			return err
+		}
+		if err := ws.checkLinkTarget(path, link); err != nil {
+			return err
+		}
+
+		if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+			return fmt.Errorf("failed to create parent directory for %s: %w", link.Path, err)
+		}
+		// Like 'ln -sf', an existing file or link is replaced
+		if err := os.Remove(path); err != nil && !os.IsNotExist(err) {
+			return fmt.Errorf("failed to replace %s: %w", link.Path, err)
+		}
+		if err := os.Symlink(link.Target, path); err != nil {
+			return fmt.Errorf("failed to create symlink %s: %w", link.Path, err)
+		}
+	}
+
+	return nil
+}
+
+// fileContent decodes the content of a file to create
+func fileContent(file client.FileCreation) ([]byte, error) {
+	switch file.Encoding {
+	case "", client.EncodingText:
+		return []byte(file.Content), nil
+	case client.EncodingBase64:
+		content, err := base64.StdEncoding.DecodeString(file.Content)
+		if err != nil {
+			return nil, fmt.Errorf("invalid base64 content for %s: %w", file.Path, err)
+		}
+		return content, nil
+	default:
+		return nil, fmt.Errorf("unknown encoding %q for %s", file.Encoding, file.Path)
+	}
+}
+
+// applyFileAttributes sets the permissions and modification time of a
+// created file, when the test asks for them
+func applyFileAttributes(path string, file client.FileCreation) error {
+	if file.Mode != "" {
+		mode, err := strconv.ParseUint(file.Mode, 8, 32)
+		if err != nil || mode > 0o7777 {
+			return fmt.Errorf("invalid mode %q for %s, expected octal like \"0755\"", file.Mode, file.Path)
+		}
+		// explicitly, the umask would drop bits when creating the file
+		if err := os.Chmod(path, fileMode(mode)); err != nil {
+			return fmt.Errorf("failed to set mode of %s: %w", file.Path, err)
+		}
+	}
+
+	if file.ModTime != "" {
+		modTime, err := time.Parse(time.RFC3339, file.ModTime)
+		if err != nil {
+			return fmt.Errorf("invalid modification time %q for %s: %w", file.ModTime, file.Path, err)
+		}
+		if err := os.Chtimes(path, modTime, modTime); err != nil {
+			return fmt.Errorf("failed to set modification time of %s: %w", file.Path, err)
 		}
 	}
 
 	return nil
 }
 
-// ExecuteCleanup performs cleanup operations after running a test
-func ExecuteCleanup(cleanup *client.TestCleanup) error {
+// fileMode converts unix permission bits, including setuid, setgid and
+// sticky, to an os.FileMode
+func fileMode(bits uint64) os.FileMode {
+	mode := os.FileMode(bits & 0o777)
+	if bits&0o4000 != 0 {
+		mode |= os.ModeSetuid
+	}
+	if bits&0o2000 != 0 {
+		mode |= os.ModeSetgid
+	}
+	if bits&0o1000 != 0 {
+		mode |= os.ModeSticky
+	}
+	return mode
+}
+
+// ExecuteCleanup performs cleanup operations after running a test, with the
+// same path rules as ExecuteSetup
+func ExecuteCleanup(cleanup *client.TestCleanup, ws *Workspace) error {
 	if cleanup == nil {
 		return nil
 	}
@@ -59,15 +181,25 @@ func ExecuteCleanup(cleanup *client.TestCleanup) error {
 
 	// Delete files
 	for _, file := range cleanup.DeleteFiles {
-		if err := os.Remove(file); err != nil && !os.IsNotExist(err) {
+		path, err := ws.resolveForDelete("delete file", file)
+		if err != nil {
+			errs = append(errs, err)
+			continue
+		}
+		if err := os.Remove(path); err != nil && !os.IsNotExist(err) {
 			errs = append(errs, fmt.Errorf("failed to delete file %s: %w", file, err))
 		}
 	}
 
 	// Delete directories (including all contents)
-	for _, dir := range cleanup.DeleteDirs {
-		if err := os.RemoveAll(dir); err != nil && !os.IsNotExist(err) {
-			errs = append(errs, fmt.Errorf("failed to delete directory %s: %w", dir, err))
+	for _, d := range cleanup.DeleteDirs {
+		path, err := ws.resolveForDelete("delete directory", d)
+		if err != nil {
+			errs = append(errs, err)
+			continue
+		}
+		if err := os.RemoveAll(path); err != nil && !os.IsNotExist(err) {
+			errs = append(errs, fmt.Errorf("failed to delete directory %s: %w", d, err))
 		}
 	}
 
@@ -0,0 +1,31 @@
+package runner
+
+import (
+	"fmt"
+	"os"
+	"os/exec"
+)
+
+// ShimCommand is the hidden 95 subcommand a program is started through when
+// its process needs preparing first, like resource limits. The shim sets up
+// its own process and then replaces itself with the program.
+const ShimCommand = "exec-shim"
+
+// wrapInShim rewrites cmd to start the program through the shim. spec tells
+// the shim what to set up, see RunShim.
+func wrapInShim(cmd *exec.Cmd, spec string) error {
+	if cmd.Err != nil {
+		// the program wasn't found, Start reports it
+		return nil
+	}
+
+	self, err := os.Executable()
+	if err != nil {
+		return fmt.Errorf("failed to locate the 95 executable: %w", err)
+	}
+
+	args := append([]string{self, ShimCommand, spec, cmd.Path}, cmd.Args[1:]...)
+	cmd.Path = self
+	cmd.Args = args
+	return nil
+}
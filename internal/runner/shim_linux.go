@@ -0,0 +1,68 @@
+package runner
+
+import (
+	"fmt"
+	"os"
+	"os/exec"
+	"strings"
+	"syscall"
+
+	"github.com/chibuka/95/client"
+)
+
+// networkSpec is the shim spec item that sets up an isolated network, see
+// isolateNetwork
+const networkSpec = "net"
+
+// prepareProcess makes cmd start through the shim when its process needs
+// preparing: resource limits, and no network access if noNetwork is set
+func prepareProcess(cmd *exec.Cmd, limits client.Limits, noNetwork bool) error {
+	spec, err := limitSpec(limits)
+	if err != nil {
+		return err
+	}
+	if noNetwork {
+		isolateNetwork(cmd)
+		// the loopback interface must be up before the limits apply
+		spec = append([]string{networkSpec}, spec...)
+	}
+
+	if len(spec) == 0 {
+		return nil
+	}
+	return wrapInShim(cmd, strings.Join(spec, ","))
+}
+
+// RunShim runs inside the shim process: it applies the spec written by
+// wrapInShim and execs the program. args are the spec, the program path and
+// its arguments. Without a program it only applies the spec, which is how
+// CheckNetworkIsolation probes it. It only returns if something went wrong.
+func RunShim(args []string) error {
+	if len(args) < 1 {
+		return fmt.Errorf("usage: 95 %s <spec> [program] [args...]", ShimCommand)
+	}
+
+	if args[0] != "" {
+		for _, item := range strings.Split(args[0], ",") {
+			var err error
+			if item == networkSpec {
+				err = setupNetwork()
+			} else {
+				err = setRlimit(item)
+			}
+			if err != nil {
+				return err
+			}
+		}
+	}
+	if len(args) < 2 {
+		return nil
+	}
+
+	// argv[0] is the program path, as if it was started directly
+	path := args[1]
+	if err := syscall.Exec(path, args[1:], os.Environ()); err != nil {
+		return fmt.Errorf("failed to start %s: %w", path, err)
+	}
+	return nil
+}
@@ -0,0 +1,22 @@
+//go:build !linux
+
+package runner
+
+import (
+	"fmt"
+	"os/exec"
+
+	"github.com/chibuka/95/client"
+)
+
+// prepareProcess does nothing, limits other than the output size and network
+// isolation are only supported on Linux
+func prepareProcess(cmd *exec.Cmd, limits client.Limits, noNetwork bool) error {
+	return nil
+}
+
+// RunShim is only used on Linux, where processes are prepared before the
+// program starts
+func RunShim(args []string) error {
+	return fmt.Errorf("%s is not supported on this platform", ShimCommand)
+}
@@ -0,0 +1,109 @@
+package runner
+
+import (
+	"context"
+	"fmt"
+	"maps"
+	"time"
+
+	"github.com/chibuka/95/client"
+)
+
+// StageServer keeps one server process running across the HTTP tests of a
+// stage whose server lifetime is "stage", instead of starting one per test.
+// It is started again for tests that ask for a fresh server, for tests whose
+// options (environment, limits) differ from the ones it was started with, and
+// after a crash. Tests must not run against it at the same time.
+type StageServer struct {
+	programConfig *client.ProgramConfig
+	serverConfig  *client.ServerConfig
+	command       *Command
+
+	server *httpServerRunner
+	// what the running server was started with
+	opts TestOptions
+	// set until the first test on a new server ran, it is charged with the
+	// startup
+	started bool
+}
+
+// NewStageServer returns a stage server, nothing starts before the first test
+func NewStageServer(programConfig *client.ProgramConfig, serverConfig *client.ServerConfig, command *Command) *StageServer {
+	return &StageServer{
+		programConfig: programConfig,
+		serverConfig:  serverConfig,
+		command:       command,
+	}
+}
+
+// NeedsStart reports whether test runs on a new server process: none is
+// running, the last one exited, the test asks for a fresh one, or the server
+// runs with other options than the test's
+func (s *StageServer) NeedsStart(test client.Test, opts TestOptions) bool {
+	return s.server == nil || s.server.hasExited() || test.FreshServer || !sameServerOptions(s.opts, opts)
+}
+
+// sameServerOptions reports whether a server started with a runs the way b
+// asks for. The directory doesn't count, the server keeps the one it started
+// in, and neither does the input mode, which is for CLI tests.
+func sameServerOptions(a, b TestOptions) bool {
+	return maps.Equal(a.Env, b.Env) && a.Limits == b.Limits &&
+		a.Hermetic == b.Hermetic && a.NoNetwork == b.NoNetwork
+}
+
+// RunTest sends the requests of test to the server, which is started first if
+// NeedsStart says so
+func (s *StageServer) RunTest(ctx context.Context, test client.Test, opts TestOptions) (*client.TestResult, error) {
+	if s.programConfig == nil {
+		return nil, fmt.Errorf("program config is required for HTTP tests")
+	}
+	if s.serverConfig == nil {
+		return nil, fmt.Errorf("server config is required for HTTP tests")
+	}
+
+	if s.NeedsStart(test, opts) {
+		s.Stop()
+		server := &httpServerRunner{config: s.serverConfig}
+		if err := server.startServer(ctx, s.programConfig, s.command, opts); err != nil {
+			server.stopServer()
+			return server.startupFailure(test, err), nil
+		}
+		s.server = server
+		s.opts = opts
+		s.started = true
+	}
+
+	// the test that started the server is charged with its startup, and
+	// gets the readiness checks
+	var before processUsage
+	var probes []client.ProbeAttempt
+	var output outputMark
+	if s.started {
+		probes = s.server.probes
+	} else {
+		before = s.server.sampler.totals()
+		output = s.server.mark()
+	}
+	s.started = false
+
+	start := time.Now()
+	result, err := s.server.sendRequests(ctx, test)
+	if err != nil {
+		// this also lets the next test see that the server crashed
+		result.ExitCode = -1
+		result.Stderr = s.server.requestError(err).Error()
+	}
+	result.Usage = s.server.sampler.since(before, time.Since(start))
+	result.ServerOutput = s.server.outputSince(output)
+	result.Environment = s.server.env
+	result.ReadinessProbes = probes
+	return result, nil
+}
+
+// Stop stops the server if one is running
+func (s *StageServer) Stop() {
+	if s.server != nil {
+		s.server.stopServer()
+		s.server = nil
+	}
+}
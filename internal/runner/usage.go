@@ -0,0 +1,137 @@
+package runner
+
+import (
+	"os"
+	"sync"
+	"time"
+
+	"github.com/chibuka/95/client"
+)
+
+// usageSampleInterval is how often a server's processes are sampled
+const usageSampleInterval = 100 * time.Millisecond
+
+// measureUsage reads what an exited program used from its process state.
+// When the program ran through the shim, the shim's own memory counts
+// towards the peak too.
+func measureUsage(state *os.ProcessState, wall time.Duration) *client.ResourceUsage {
+	usage := &client.ResourceUsage{WallMs: wall.Milliseconds()}
+	if state == nil {
+		return usage
+	}
+	usage.UserMs = state.UserTime().Milliseconds()
+	usage.SystemMs = state.SystemTime().Milliseconds()
+	usage.PeakRSSKB = peakRSSKB(state)
+	return usage
+}
+
+// processUsage is one sample of a running process
+type processUsage struct {
+	user   time.Duration
+	system time.Duration
+	rssKB  int64
+}
+
+// usageSampler follows the processes of a long running program, like an HTTP
+// server, that can't be measured only once it exits. Its children don't show
+// up in the process state of the server unless it waits for them.
+type usageSampler struct {
+	pgid  int
+	start time.Time
+	stop  chan struct{}
+	done  chan struct{}
+
+	mu        sync.Mutex
+	latest    map[int]processUsage // last sample of every process seen
+	peakRSSKB int64                // of the whole group at once
+}
+
+// startUsageSampler samples the process group every usageSampleInterval
+// until finish is called
+func startUsageSampler(pgid int) *usageSampler {
+	s := &usageSampler{
+		pgid:   pgid,
+		start:  time.Now(),
+		stop:   make(chan struct{}),
+		done:   make(chan struct{}),
+		latest: make(map[int]processUsage),
+	}
+
+	go func() {
+		defer close(s.done)
+		ticker := time.NewTicker(usageSampleInterval)
+		defer ticker.Stop()
+		for {
+			s.sample()
+			select {
+			case <-s.stop:
+				return
+			case <-ticker.C:
+			}
+		}
+	}()
+	return s
+}
+
+func (s *usageSampler) sample() {
+	samples := sampleProcessGroup(s.pgid)
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	var rss int64
+	for pid, sample := range samples {
+		s.latest[pid] = sample
+		rss += sample.rssKB
+	}
+	s.peakRSSKB = max(s.peakRSSKB, rss)
+}
+
+// totals samples the processes now and returns the CPU time they used so far,
+// with the peak memory of the group in rssKB
+func (s *usageSampler) totals() processUsage {
+	s.sample()
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.sum()
+}
+
+// sum adds up the last samples, s.mu must be held
+func (s *usageSampler) sum() processUsage {
+	total := processUsage{rssKB: s.peakRSSKB}
+	for _, sample := range s.latest {
+		total.user += sample.user
+		total.system += sample.system
+	}
+	return total
+}
+
+// since is what the processes used from an earlier call to totals until now,
+// for a server that outlives a single test. The peak memory is that of the
+// server's whole life so far.
+func (s *usageSampler) since(before processUsage, wall time.Duration) *client.ResourceUsage {
+	now := s.totals()
+	return &client.ResourceUsage{
+		WallMs:    wall.Milliseconds(),
+		UserMs:    (now.user - before.user).Milliseconds(),
+		SystemMs:  (now.system - before.system).Milliseconds(),
+		PeakRSSKB: now.rssKB,
+	}
+}
+
+// finish stops sampling. The totals are taken together with the state of the
+// exited leader, whichever saw more, as samples miss the last moments.
+func (s *usageSampler) finish(state *os.ProcessState) *client.ResourceUsage {
+	close(s.stop)
+	<-s.done
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	sampled := s.sum()
+
+	usage := measureUsage(state, time.Since(s.start))
+	usage.UserMs = max(usage.UserMs, sampled.user.Milliseconds())
+	usage.SystemMs = max(usage.SystemMs, sampled.system.Milliseconds())
+	usage.PeakRSSKB = max(usage.PeakRSSKB, s.peakRSSKB)
+	return usage
+}
@@ -0,0 +1,21 @@
+package runner
+
+import (
+	"os"
+	"syscall"
+)
+
+// peakRSSKB is the largest resident set of the process, macOS reports it in bytes
+func peakRSSKB(state *os.ProcessState) int64 {
+	rusage, ok := state.SysUsage().(*syscall.Rusage)
+	if !ok {
+		return 0
+	}
+	return rusage.Maxrss >> 10
+}
+
+// sampleProcessGroup is not supported without /proc, servers are measured
+// from their exit state only
+func sampleProcessGroup(pgid int) map[int]processUsage {
+	return nil
+}
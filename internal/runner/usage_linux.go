@@ -0,0 +1,72 @@
+package runner
+
+import (
+	"os"
+	"strconv"
+	"strings"
+	"syscall"
+	"time"
+)
+
+// clockTicks is the unit of the CPU times in /proc/<pid>/stat. It is 100 on
+// every Linux architecture Go supports.
+const clockTicks = 100
+
+// peakRSSKB is the largest resident set of the process, Linux reports it in KB
+func peakRSSKB(state *os.ProcessState) int64 {
+	rusage, ok := state.SysUsage().(*syscall.Rusage)
+	if !ok {
+		return 0
+	}
+	return rusage.Maxrss
+}
+
+// sampleProcessGroup reads the CPU time and memory of every live process in a
+// process group from /proc
+func sampleProcessGroup(pgid int) map[int]processUsage {
+	entries, err := os.ReadDir("/proc")
+	if err != nil {
+		return nil
+	}
+
+	pageKB := int64(os.Getpagesize() >> 10)
+	samples := make(map[int]processUsage)
+	for _, entry := range entries {
+		pid, err := strconv.Atoi(entry.Name())
+		if err != nil {
+			continue
+		}
+
+		stat, err := os.ReadFile("/proc/" + entry.Name() + "/stat")
+		if err != nil {
+			// the process exited while we were looking
+			continue
+		}
+
+		// format: pid (comm) state ppid pgrp ... utime stime ... rss ...
+		// comm may contain spaces and parentheses, so split on the last ')'
+		s := string(stat)
+		end := strings.LastIndexByte(s, ')')
+		if end < 0 {
+			continue
+		}
+		fields := strings.Fields(s[end+1:])
+		if len(fields) < 22 || fields[0] == "Z" {
+			continue
+		}
+		if group, err := strconv.Atoi(fields[2]); err != nil || group != pgid {
+			continue
+		}
+
+		utime, _ := strconv.ParseInt(fields[11], 10, 64)
+		stime, _ := strconv.ParseInt(fields[12], 10, 64)
+		rss, _ := strconv.ParseInt(fields[21], 10, 64)
+		samples[pid] = processUsage{
+			user:   time.Duration(utime) * time.Second / clockTicks,
+			system: time.Duration(stime) * time.Second / clockTicks,
+			rssKB:  rss * pageKB,
+		}
+	}
+
+	return samples
+}
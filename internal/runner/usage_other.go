@@ -0,0 +1,16 @@
+//go:build !linux && !darwin
+
+package runner
+
+import "os"
+
+// peakRSSKB is not reported in a portable way here
+func peakRSSKB(state *os.ProcessState) int64 {
+	return 0
+}
+
+// sampleProcessGroup is not supported without /proc, servers are measured
+// from their exit state only
+func sampleProcessGroup(pgid int) map[int]processUsage {
+	return nil
+}
@@ -0,0 +1,169 @@
+package runner
+
+import (
+	"fmt"
+	"io"
+	"io/fs"
+	"os"
+	"path/filepath"
+
+	"github.com/chibuka/95/internal/project"
+)
+
+// Sandbox modes, how a sandbox is seeded from the project
+const (
+	// Every file is copied, dependency and build output directories
+	// included. The program can't touch the project, but seeding is slower.
+	SandboxCopy = "copy"
+	// Every file is a symlink to the project. Seeding is fast, setup
+	// operations stay inside the sandbox, but the program itself can still
+	// write through the links into project files.
+	SandboxLink = "link"
+)
+
+// Workspace is the directory a test runs in: the project itself, or a
+// sandbox seeded from it that is thrown away after the test
+type Workspace struct {
+	Dir     string
+	Sandbox bool
+	// AllowTrackedDeletes lets setup and cleanup delete files tracked by git
+	AllowTrackedDeletes bool
+	// the project a link sandbox was seeded from, symlinks resolved
+	linkedFrom string
+}
+
+// ProjectWorkspace runs tests directly in the project directory
+func ProjectWorkspace(root string) *Workspace {
+	return &Workspace{Dir: root}
+}
+
+// NewSandbox creates a fresh temporary directory seeded from the project
+func NewSandbox(root string, mode string) (*Workspace, error) {
+	if mode != SandboxCopy && mode != SandboxLink {
+		return nil, fmt.Errorf("unknown sandbox mode %q (use %q or %q)", mode, SandboxCopy, SandboxLink)
+	}
+
+	dir, err := os.MkdirTemp("", "95-sandbox-")
+	if err != nil {
+		return nil, fmt.Errorf("failed to create sandbox: %w", err)
+	}
+
+	if err := seedSandbox(root, dir, mode); err != nil {
+		_ = os.RemoveAll(dir)
+		return nil, fmt.Errorf("failed to seed sandbox: %w", err)
+	}
+
+	workspace := &Workspace{Dir: dir, Sandbox: true}
+	if mode == SandboxLink {
+		if workspace.linkedFrom, err = filepath.EvalSymlinks(root); err != nil {
+			_ = os.RemoveAll(dir)
+			return nil, fmt.Errorf("failed to resolve project directory: %w", err)
+		}
+	}
+	return workspace, nil
+}
+
+// isSeededLink reports whether path, a link in the sandbox that resolves to
+// target, is still the link to the project file it was seeded with: the test
+// left that file as it was
+func (w *Workspace) isSeededLink(root string, path string, target string) bool {
+	if w.linkedFrom == "" {
+		return false
+	}
+	rel, err := filepath.Rel(root, path)
+	if err != nil {
+		return false
+	}
+	return filepath.Join(w.linkedFrom, rel) == target
+}
+
+// Remove deletes a sandbox, the project directory is never removed
+func (w *Workspace) Remove() error {
+	if !w.Sandbox {
+		return nil
+	}
+	return os.RemoveAll(w.Dir)
+}
+
+func seedSandbox(root string, dir string, mode string) error {
+	root, err := filepath.Abs(root)
+	if err != nil {
+		return err
+	}
+
+	return filepath.WalkDir(root, func(path string, d fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		if path == root {
+			return nil
+		}
+
+		rel, err := filepath.Rel(root, path)
+		if err != nil {
+			return err
+		}
+		target := filepath.Join(dir, rel)
+
+		switch {
+		case d.IsDir() && project.IsVCSDir(d.Name()):
+			return filepath.SkipDir
+
+		case d.IsDir() && project.IsIgnoredDir(d.Name()) && mode == SandboxLink:
+			// dependencies and build outputs are linked as a whole
+			if err := os.Symlink(path, target); err != nil {
+				return err
+			}
+			return filepath.SkipDir
+
+		case d.IsDir():
+			info, err := d.Info()
+			if err != nil {
+				return err
+			}
+			return os.Mkdir(target, info.Mode().Perm())
+
+		case d.Type()&fs.ModeSymlink != 0:
+			// same link, relative links still resolve inside the sandbox
+			link, err := os.Readlink(path)
+			if err != nil {
+				return err
+			}
+			return os.Symlink(link, target)
+
+		case mode == SandboxLink:
+			return os.Symlink(path, target)
+
+		default:
+			return copyFile(path, target)
+		}
+	})
+}
+
+// copyFile copies a regular file, keeping its permissions
+func copyFile(src string, dst string) error {
+	in, err := os.Open(src)
+	if err != nil {
+		return err
+	}
+	defer in.Close()
+
+	info, err := in.Stat()
+	if err != nil {
+		return err
+	}
+	if !info.Mode().IsRegular() {
+		// sockets, fifos and devices have no content to copy
+		return nil
+	}
+
+	out, err := os.OpenFile(dst, os.O_WRONLY|os.O_CREATE|os.O_TRUNC, info.Mode().Perm())
+	if err != nil {
+		return err
+	}
+	if _, err := io.Copy(out, in); err != nil {
+		out.Close()
+		return err
+	}
+	return out.Close()
+}
@@ -9,6 +9,13 @@ type StartStepMsg struct {
 	StageName   string
 }
 
+// SkipStepMsg is sent instead of StartStepMsg for a stage that already
+// passed for the current sources
+type SkipStepMsg struct {
+	StageNumber int
+	StageName   string
+}
+
 // StartTestMsg is sent when a test begins execution
 type StartTestMsg struct {
 	TestName string
@@ -25,6 +32,63 @@ type ResolveTestMsg struct {
 	Stderr        string
 	ExitCode      int
 	FailureReason string
+	Transcript    []TranscriptEntry // per-command output, when the runner recorded one
+	TimedOut      bool
+	Signal        string // signal that killed the program, e.g. "SIGSEGV"
+	DurationMs    int64
+	Reaped        []string // leftover processes killed after the test, "<pid> <command>"
+	Files         []FileArtifact
+	Limit         string // resource limit that stopped the program, e.g. "memory"
+	Usage         *ResourceUsage
+	Attempts      *Attempts // set when the test was run more than once
+}
+
+// TranscriptEntry pairs a command with the output it produced
+type TranscriptEntry struct {
+	Command   string
+	Output    string
+	ElapsedMs int64
+}
+
+// FileArtifact is a file the program left behind, collected after the test
+type FileArtifact struct {
+	Path      string
+	Exists    bool
+	Size      int64
+	Content   string // empty for binary files
+	Binary    bool
+	Truncated bool
+	Error     string // set when the path couldn't be collected
+}
+
+// ResourceUsage is the time and memory a test's program used
+type ResourceUsage struct {
+	WallMs    int64
+	CPUMs     int64 // user and system time
+	PeakRSSKB int64 // 0 if unknown
+}
+
+// Attempts describes the reruns of a test, and whether they behaved the same
+type Attempts struct {
+	Count int
+	Flaky bool
+	// the attempts that differed, Diff goes from Before to After
+	Before int
+	After  int
+	Diff   []DiffLine // empty when only the validation differed
+}
+
+// Kinds of DiffLine
+const (
+	DiffSame    = ' '
+	DiffAdded   = '+'
+	DiffRemoved = '-'
+)
+
+// DiffLine is one line of a diff between two outputs
+type DiffLine struct {
+	Kind rune
+	Text string
 }
 
 // ResolveStepMsg is sent when a stage/step completes
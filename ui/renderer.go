@@ -3,7 +3,6 @@ package ui
 import (
 	"fmt"
 	"strings"
-	"time"
 
 	"github.com/charmbracelet/lipgloss"
 	"github.com/chibuka/95/ui/messages"
@@ -17,6 +16,13 @@ var (
 	gray = lipgloss.NewStyle().Foreground(lipgloss.Color("240"))
 )
 
+// Styles for output the commands print themselves, so it matches the renderer
+var (
+	SuccessStyle = green
+	FailureStyle = orange.Bold(true)
+	MutedStyle   = gray
+)
+
 type testModel struct {
 	name          string
 	running       bool
@@ -26,6 +32,15 @@ type testModel struct {
 	stderr        string
 	exitCode      int
 	failureReason string
+	transcript    []messages.TranscriptEntry
+	timedOut      bool
+	signal        string
+	durationMs    int64
+	reaped        []string
+	files         []messages.FileArtifact
+	limit         string
+	usage         *messages.ResourceUsage
+	attempts      *messages.Attempts
 	shown         bool // Track if this test has been displayed
 }
 
@@ -43,7 +58,11 @@ func StartRenderer(isSubmit bool, ch chan messages.Msg) func(success bool, total
 
 	fmt.Println() // Initial newline
 
+	// closed once every message is processed, steps is safe to read after
+	finished := make(chan struct{})
+
 	go func() {
+		defer close(finished)
 		for msg := range ch {
 			switch msg := msg.(type) {
 			case messages.StartStepMsg:
@@ -59,6 +78,19 @@ func StartRenderer(isSubmit bool, ch chan messages.Msg) func(success bool, total
 				header := fmt.Sprintf("Stage %02d: %s", msg.StageNumber, msg.StageName)
 				fmt.Println(header)
 
+			case messages.SkipStepMsg:
+				// Keep step indexes in line with the stages, but nothing runs
+				passed := true
+				steps = append(steps, stepModel{
+					stageNumber: msg.StageNumber,
+					stageName:   msg.StageName,
+					passed:      &passed,
+				})
+				currentStep = -1
+
+				header := fmt.Sprintf("Stage %02d: %s", msg.StageNumber, msg.StageName)
+				fmt.Println(header + gray.Render("  ✓ verified for these sources, skipped (--full to run)"))
+
 			case messages.StartTestMsg:
 				// New test starting - only store it, don't print anything
 				if currentStep >= 0 {
@@ -81,6 +113,15 @@ func StartRenderer(isSubmit bool, ch chan messages.Msg) func(success bool, total
 					test.stderr = msg.Stderr
 					test.exitCode = msg.ExitCode
 					test.failureReason = msg.FailureReason
+					test.transcript = msg.Transcript
+					test.timedOut = msg.TimedOut
+					test.signal = msg.Signal
+					test.durationMs = msg.DurationMs
+					test.reaped = msg.Reaped
+					test.files = msg.Files
+					test.limit = msg.Limit
+					test.usage = msg.Usage
+					test.attempts = msg.Attempts
 
 					// In test mode (isSubmit=false), show all tests immediately
 					// In run mode (isSubmit=true), only show validated tests (passed != nil)
@@ -103,8 +144,8 @@ func StartRenderer(isSubmit bool, ch chan messages.Msg) func(success bool, total
 	return func(success bool, totalTests, passedTests int, feedback string) {
 		close(ch)
 
-		// Wait a bit for remaining messages to be processed
-		time.Sleep(100 * time.Millisecond)
+		// Wait for remaining messages to be processed
+		<-finished
 
 		if isSubmit {
 			// Print final summary
@@ -118,6 +159,8 @@ func StartRenderer(isSubmit bool, ch chan messages.Msg) func(success bool, total
 			}
 		}
 
+		displayStageUsage(steps)
+
 		if feedback != "" {
 			fmt.Println(gray.Render(feedback))
 		}
@@ -177,42 +220,13 @@ func displayTest(test *testModel, testIndex int, totalTestsInStage int, isSubmit
 	// TEST MODE: Show all stdin/stdout without validation icons
 	if !isSubmit {
 		// Print test name without status icon (no validation)
-		fmt.Printf("  %s %s\n", connector, test.name)
+		fmt.Printf("  %s %s%s%s\n", connector, test.name, formatTestStats(test), flakyTag(test))
 
 		// Always show command/output pairs in test mode
-		if test.stdin != "" {
-			commands := strings.Split(strings.TrimRight(test.stdin, "\n"), "\n")
-
-			// Parse output by splitting on "$ " to get each command's response
-			outputParts := strings.Split(test.stdout, "$ ")
-			// Remove empty first element (before first prompt)
-			if len(outputParts) > 0 && outputParts[0] == "" {
-				outputParts = outputParts[1:]
-			}
-
-			fmt.Println()
-			for i, cmd := range commands {
-				// Print command
-				fmt.Println(indent + orange.Render("$ ") + cmd)
-
-				// Match output for this command
-				if i < len(outputParts) {
-					output := strings.TrimSpace(outputParts[i])
-
-					if output == "" {
-						fmt.Println(indent + gray.Render("  (no output)"))
-					} else {
-						// Split multi-line outputs
-						for _, line := range strings.Split(output, "\n") {
-							if line != "" {
-								fmt.Println(indent + gray.Render("  "+line))
-							}
-						}
-					}
-				}
-				fmt.Println()
-			}
-		}
+		displayCommands(test, indent, lipgloss.NewStyle())
+		displayOutcome(test, indent)
+		displayAttempts(test, indent)
+		displayFiles(test, indent)
 
 		// Show stderr if present (but skip common build noise)
 		if test.stderr != "" && !isBuildNoise(test.stderr) {
@@ -233,45 +247,19 @@ func displayTest(test *testModel, testIndex int, totalTestsInStage int, isSubmit
 	}
 
 	// Print the test result line
-	fmt.Printf("  %s %s %s\n", connector, statusIcon, test.name)
+	fmt.Printf("  %s %s %s%s%s\n", connector, statusIcon, test.name, formatTestStats(test), flakyTag(test))
 
 	// Only show details for FAILED tests (keeps output clean for passing tests)
 	isPassed := test.passed != nil && *test.passed
-	if !isPassed {
-		// Parse stdin commands and match with output
-		if test.stdin != "" {
-			commands := strings.Split(strings.TrimRight(test.stdin, "\n"), "\n")
-
-			// Parse output by splitting on "$ " to get each command's response
-			outputParts := strings.Split(test.stdout, "$ ")
-			// Remove empty first element (before first prompt)
-			if len(outputParts) > 0 && outputParts[0] == "" {
-				outputParts = outputParts[1:]
-			}
-
-			fmt.Println()
-			for i, cmd := range commands {
-				// Print command
-				fmt.Println(indent + orange.Render("$ ") + gray.Render(cmd))
-
-				// Match output for this command
-				if i < len(outputParts) {
-					output := strings.TrimSpace(outputParts[i])
-
-					if output == "" {
-						fmt.Println(indent + gray.Render("  (no output)"))
-					} else {
-						// Split multi-line outputs
-						for _, line := range strings.Split(output, "\n") {
-							if line != "" {
-								fmt.Println(indent + gray.Render("  "+line))
-							}
-						}
-					}
-				}
-				fmt.Println()
-			}
-		}
+	if isPassed {
+		// a pass that took reruns still deserves a look
+		displayAttempts(test, indent)
+	} else {
+		// Show stdin commands with their output
+		displayCommands(test, indent, gray)
+		displayOutcome(test, indent)
+		displayAttempts(test, indent)
+		displayFiles(test, indent)
 
 		// Show stderr if present (but skip common build noise)
 		if test.stderr != "" && !isBuildNoise(test.stderr) {
@@ -287,6 +275,241 @@ func displayTest(test *testModel, testIndex int, totalTestsInStage int, isSubmit
 	}
 }
 
+// formatTestStats renders the duration of a test for the test result line,
+// with the CPU time and peak memory of its program when they were measured
+func formatTestStats(test *testModel) string {
+	var parts []string
+	if test.durationMs > 0 {
+		parts = append(parts, formatMs(test.durationMs))
+	}
+	if test.usage != nil {
+		parts = append(parts, "cpu "+formatMs(test.usage.CPUMs))
+		if test.usage.PeakRSSKB > 0 {
+			parts = append(parts, FormatKB(test.usage.PeakRSSKB))
+		}
+	}
+	if len(parts) == 0 {
+		return ""
+	}
+	return gray.Render(" (" + strings.Join(parts, " · ") + ")")
+}
+
+// displayStageUsage prints the resource usage of each stage that ran:
+// total wall and CPU time of its tests, and the largest peak memory
+func displayStageUsage(steps []stepModel) {
+	var lines []string
+	for _, step := range steps {
+		var wallMs, cpuMs, peakKB int64
+		measured := 0
+		for _, test := range step.tests {
+			if test.usage == nil {
+				continue
+			}
+			measured++
+			wallMs += test.usage.WallMs
+			cpuMs += test.usage.CPUMs
+			peakKB = max(peakKB, test.usage.PeakRSSKB)
+		}
+		if measured == 0 {
+			continue
+		}
+
+		tests := "tests"
+		if measured == 1 {
+			tests = "test"
+		}
+		line := fmt.Sprintf("  Stage %02d: %d %s · wall %s · cpu %s", step.stageNumber, measured, tests, formatMs(wallMs), formatMs(cpuMs))
+		if peakKB > 0 {
+			line += " · peak " + FormatKB(peakKB)
+		}
+		lines = append(lines, line)
+	}
+	if len(lines) == 0 {
+		return
+	}
+
+	fmt.Println()
+	fmt.Println(gray.Render("Resource usage:"))
+	for _, line := range lines {
+		fmt.Println(gray.Render(line))
+	}
+}
+
+// formatMs renders a time in milliseconds, as seconds from one second up
+func formatMs(ms int64) string {
+	if ms < 1000 {
+		return fmt.Sprintf("%dms", ms)
+	}
+	return fmt.Sprintf("%.1fs", float64(ms)/1000)
+}
+
+// FormatMicros renders a time in microseconds, for timings finer than formatMs
+func FormatMicros(us int64) string {
+	switch {
+	case us < 1000:
+		return fmt.Sprintf("%dµs", us)
+	case us < 1000_000:
+		return fmt.Sprintf("%.1fms", float64(us)/1000)
+	default:
+		return fmt.Sprintf("%.2fs", float64(us)/1000_000)
+	}
+}
+
+// FormatKB renders a memory size in KB
+func FormatKB(kb int64) string {
+	if kb < 1024 {
+		return fmt.Sprintf("%d KB", kb)
+	}
+	return fmt.Sprintf("%.1f MB", float64(kb)/1024)
+}
+
+// displayOutcome explains how the program ended when it did not exit on its own
+func displayOutcome(test *testModel, indent string) {
+	switch {
+	case test.limit != "":
+		fmt.Println(indent + orange.Render("⛔ "+describeLimit(test.limit)))
+		fmt.Println()
+	case test.timedOut:
+		fmt.Println(indent + orange.Render("⏱ Timed out, the output above is what it printed before being stopped"))
+		fmt.Println()
+	case test.signal != "":
+		fmt.Println(indent + orange.Render("Killed by "+test.signal))
+		fmt.Println()
+	}
+
+	if len(test.reaped) > 0 {
+		fmt.Println(indent + gray.Render("Killed leftover processes: "+strings.Join(test.reaped, ", ")))
+		fmt.Println()
+	}
+}
+
+// flakyTag marks a flaky test on its result line
+func flakyTag(test *testModel) string {
+	if test.attempts == nil || !test.attempts.Flaky {
+		return ""
+	}
+	return orange.Render("  ⚠ flaky")
+}
+
+// displayAttempts explains how the reruns of a test went: what changed
+// between attempts of a flaky test, or that a failure is repeatable
+func displayAttempts(test *testModel, indent string) {
+	attempts := test.attempts
+	if attempts == nil {
+		return
+	}
+
+	switch {
+	case !attempts.Flaky && test.passed != nil && !*test.passed:
+		fmt.Println(indent + gray.Render(fmt.Sprintf("Failed the same way in all %d attempts", attempts.Count)))
+		fmt.Println()
+		return
+	case !attempts.Flaky:
+		return
+	case len(attempts.Diff) == 0:
+		fmt.Println(indent + orange.Render(fmt.Sprintf("⚠ Flaky: failed, then passed on attempt %d with the same output", attempts.After)))
+		fmt.Println()
+		return
+	}
+
+	fmt.Println(indent + orange.Render(fmt.Sprintf("⚠ Flaky: attempts %d and %d printed different output", attempts.Before, attempts.After)))
+	for _, line := range attempts.Diff {
+		switch line.Kind {
+		case messages.DiffRemoved:
+			fmt.Println(indent + orange.Render("  - "+line.Text))
+		case messages.DiffAdded:
+			fmt.Println(indent + green.UnsetBold().Render("  + "+line.Text))
+		default:
+			fmt.Println(indent + gray.Render("    "+line.Text))
+		}
+	}
+	fmt.Println()
+}
+
+// displayFiles prints the files the program left behind, when the test
+// collected any
+func displayFiles(test *testModel, indent string) {
+	for _, file := range test.files {
+		switch {
+		case file.Error != "":
+			fmt.Println(indent + orange.Render("▤ "+file.Path) + gray.Render("  (not collected: "+file.Error+")"))
+		case !file.Exists:
+			fmt.Println(indent + orange.Render("▤ "+file.Path) + gray.Render("  (missing)"))
+		case file.Binary:
+			fmt.Println(indent + orange.Render("▤ "+file.Path) + gray.Render(fmt.Sprintf("  (binary, %d bytes)", file.Size)))
+		default:
+			fmt.Println(indent + orange.Render("▤ "+file.Path) + gray.Render(fmt.Sprintf("  (%d bytes)", file.Size)))
+			displayCommandOutput(file.Content, indent)
+			if file.Truncated {
+				fmt.Println(indent + gray.Render("  …"))
+			}
+		}
+		fmt.Println()
+	}
+}
+
+// describeLimit explains which resource limit a program ran into
+func describeLimit(limit string) string {
+	switch limit {
+	case "memory":
+		return "Memory limit exceeded"
+	case "cpu":
+		return "CPU time limit exceeded"
+	case "processes":
+		return "Process limit exceeded"
+	case "open_files":
+		return "Open files limit exceeded"
+	case "output":
+		return "Output limit exceeded"
+	default:
+		return "Limit exceeded: " + limit
+	}
+}
+
+// displayCommands prints each stdin command followed by the output it produced
+func displayCommands(test *testModel, indent string, cmdStyle lipgloss.Style) {
+	// The runner recorded exactly what each command printed
+	if len(test.transcript) > 0 {
+		fmt.Println()
+		for _, entry := range test.transcript {
+			elapsed := gray.Render(fmt.Sprintf("  (%dms)", entry.ElapsedMs))
+			fmt.Println(indent + orange.Render("$ ") + cmdStyle.Render(entry.Command) + elapsed)
+			displayCommandOutput(entry.Output, indent)
+			fmt.Println()
+		}
+		return
+	}
+
+	if test.stdin == "" {
+		return
+	}
+
+	// No transcript (e.g. HTTP tests), the input and then the output as it
+	// was printed
+	fmt.Println()
+	for _, cmd := range strings.Split(strings.TrimRight(test.stdin, "\n"), "\n") {
+		fmt.Println(indent + orange.Render("$ ") + cmdStyle.Render(cmd))
+	}
+	displayCommandOutput(test.stdout, indent)
+	fmt.Println()
+}
+
+// displayCommandOutput prints the output of a single command
+func displayCommandOutput(output string, indent string) {
+	output = strings.TrimSpace(output)
+	if output == "" {
+		fmt.Println(indent + gray.Render("  (no output)"))
+		return
+	}
+
+	// Split multi-line outputs
+	for _, line := range strings.Split(output, "\n") {
+		if line != "" {
+			fmt.Println(indent + gray.Render("  "+line))
+		}
+	}
+}
+
 // formatErrorOutput formats error messages for better readability
 func formatErrorOutput(stderr string, indent string) {
 	lines := strings.Split(strings.TrimRight(stderr, "\n"), "\n")